@@ -6,6 +6,5 @@ require (
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
+	golang.org/x/sys v0.4.0
 )
-
-require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,310 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/voclinx/scanarr-watcher/internal/hash"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
+	"github.com/voclinx/scanarr-watcher/internal/scanner"
+)
+
+// Watcher is what commands need of the file watcher.
+type Watcher interface {
+	Available(path string) bool
+	AddPath(path string) error
+	RemovePath(path string) error
+}
+
+// Deleter is what commands need of the file deleter. Both run to completion and
+// report their own results.
+type Deleter interface {
+	ProcessDeleteCommand(cmd models.CommandFilesDeleteData)
+	ProcessHardlinkCommand(cmd models.CommandFilesHardlinkData)
+}
+
+// Handler runs the commands of the API and replies to them.
+type Handler struct {
+	publisher publisher.EventPublisher
+	scans     *scanner.Manager
+	watcher   Watcher
+	deleter   Deleter
+	hashCache *hash.Cache
+
+	// RepliesEnabled, if set, tells whether the API expects command replies: one
+	// that negotiated the protocol without command.reply does not.
+	RepliesEnabled func() bool
+
+	// DeletionDisabled, if set, tells whether the watcher config forbids deletions.
+	DeletionDisabled func() bool
+}
+
+// NewHandler creates a Handler running commands with the given components.
+func NewHandler(pub publisher.EventPublisher, scans *scanner.Manager, w Watcher, d Deleter, hashCache *hash.Cache) *Handler {
+	return &Handler{
+		publisher: pub,
+		scans:     scans,
+		watcher:   w,
+		deleter:   d,
+		hashCache: hashCache,
+	}
+}
+
+// Reply sends a reply of replyType (Accepted, Rejected or Failed) to msg.
+func (h *Handler) Reply(msg models.Message, replyType, reason string, err error) {
+	h.send(replyType, NewReply(msg, reason, err))
+}
+
+// send sends a reply built by NewReply.
+func (h *Handler) send(replyType string, reply models.CommandReplyData) {
+	if h.RepliesEnabled != nil && !h.RepliesEnabled() {
+		return
+	}
+	h.publisher.SendEvent(replyType, reply)
+}
+
+// requireDir returns an error if path is empty or not an existing directory.
+func requireDir(path string) (reason string, err error) {
+	if path == "" {
+		return ReasonInvalidPayload, errors.New("path is required")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ReasonPathNotFound, err
+	}
+	if !info.IsDir() {
+		return ReasonPathNotFound, fmt.Errorf("%s is not a directory", path)
+	}
+	return "", nil
+}
+
+// Handle runs the command in msg. Long work (scans, deletions) continues in the
+// background once the command is accepted; its outcome is reported by its own
+// events, or by command.failed.
+func (h *Handler) Handle(msg models.Message) {
+	reject := func(reason string, err error) {
+		slog.Warn("Command rejected", "type", msg.Type, "reason", reason, "error", err)
+		h.Reply(msg, Rejected, reason, err)
+	}
+	accept := func() {
+		h.Reply(msg, Accepted, "", nil)
+	}
+	fail := func(reason string, err error) {
+		h.Reply(msg, Failed, reason, err)
+	}
+
+	switch msg.Type {
+	case "command.scan":
+		var scanCmd models.CommandScanData
+		if err := Decode(msg, &scanCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		if reason, err := requireDir(scanCmd.Path); err != nil {
+			reject(reason, err)
+			return
+		}
+		mode := scanner.ModeFull
+		switch scanCmd.Mode {
+		case "", scanner.ModeFull:
+		case scanner.ModeIncremental:
+			mode = scanner.ModeIncremental
+		default:
+			reject(ReasonInvalidPayload, fmt.Errorf("unknown scan mode %q", scanCmd.Mode))
+			return
+		}
+		if !h.watcher.Available(scanCmd.Path) {
+			reject(ReasonVolumeUnavailable, fmt.Errorf("%w: %s", scanner.ErrUnavailable, scanCmd.Path))
+			return
+		}
+		job, merged := h.scans.Submit(scanCmd.Path, scanCmd.ScanID, mode)
+		if merged {
+			// Covered by the scan already queued for the path, which the API tracks by its ID
+			reply := NewReply(msg, "", nil)
+			reply.ScanID = job.ID
+			h.send(Accepted, reply)
+		} else {
+			accept()
+		}
+		go func() {
+			h.scanDone(msg, job, job.Wait())
+		}()
+
+	case "command.scan.cancel":
+		var cancelCmd models.CommandScanCancelData
+		if err := Decode(msg, &cancelCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		if cancelCmd.ScanID == "" && cancelCmd.Path == "" {
+			reject(ReasonInvalidPayload, errors.New("scan_id or path is required"))
+			return
+		}
+		if n := h.scans.Cancel(cancelCmd.ScanID, cancelCmd.Path); n == 0 {
+			reject(ReasonScanNotFound, fmt.Errorf("no running or queued scan matches scan_id %q path %q", cancelCmd.ScanID, cancelCmd.Path))
+			return
+		}
+		accept()
+
+	case "command.scan.status":
+		var statusCmd models.CommandScanStatusData
+		if err := Decode(msg, &statusCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		accept()
+		h.publisher.SendEvent("scan.status", models.ScanStatusData{
+			RequestID: statusCmd.RequestID,
+			Scans:     h.scans.Status(),
+		})
+
+	case "command.watch.add":
+		var watchCmd models.CommandWatchData
+		if err := Decode(msg, &watchCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		if reason, err := requireDir(watchCmd.Path); err != nil {
+			reject(reason, err)
+			return
+		}
+		accept()
+		if err := h.watcher.AddPath(watchCmd.Path); err != nil {
+			slog.Error("Failed to add watch path", "path", watchCmd.Path, "error", err)
+			fail(ReasonWatchAddFailed, err)
+		} else {
+			slog.Info("Added watch path", "path", watchCmd.Path)
+		}
+
+	case "command.watch.remove":
+		var watchCmd models.CommandWatchData
+		if err := Decode(msg, &watchCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		if watchCmd.Path == "" {
+			reject(ReasonInvalidPayload, errors.New("path is required"))
+			return
+		}
+		accept()
+		if err := h.watcher.RemovePath(watchCmd.Path); err != nil {
+			slog.Error("Failed to remove watch path", "path", watchCmd.Path, "error", err)
+			fail(ReasonWatchRemoveFailed, err)
+		} else {
+			slog.Info("Removed watch path", "path", watchCmd.Path)
+		}
+
+	case "command.files.delete":
+		if h.DeletionDisabled != nil && h.DeletionDisabled() {
+			h.refuseDeletion(msg)
+			return
+		}
+		var deleteCmd models.CommandFilesDeleteData
+		if err := Decode(msg, &deleteCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		slog.Info("Received delete command",
+			"request_id", deleteCmd.RequestID,
+			"deletion_id", deleteCmd.DeletionID,
+			"files", len(deleteCmd.Files),
+		)
+		accept()
+		go h.deleter.ProcessDeleteCommand(deleteCmd)
+
+	case "command.files.hardlink":
+		var hardlinkCmd models.CommandFilesHardlinkData
+		if err := Decode(msg, &hardlinkCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		slog.Info("Received hardlink command",
+			"request_id", hardlinkCmd.RequestID,
+			"deletion_id", hardlinkCmd.DeletionID,
+			"source", hardlinkCmd.SourcePath,
+			"target", hardlinkCmd.TargetPath,
+		)
+		accept()
+		go h.deleter.ProcessHardlinkCommand(hardlinkCmd)
+
+	case "command.hash_cache.invalidate":
+		var invalidateCmd models.CommandHashCacheInvalidateData
+		if err := Decode(msg, &invalidateCmd); err != nil {
+			reject(ReasonInvalidPayload, err)
+			return
+		}
+		accept()
+		if len(invalidateCmd.Paths) == 0 {
+			slog.Info("Hash cache purged", "entries", h.hashCache.Purge())
+			return
+		}
+		for _, path := range invalidateCmd.Paths {
+			n, err := h.hashCache.Invalidate(path)
+			if err != nil {
+				slog.Error("Failed to invalidate cached hashes", "path", path, "error", err)
+				fail(ReasonInvalidateFailed, err)
+				return
+			}
+			slog.Info("Cached hashes invalidated", "path", path, "entries", n)
+		}
+
+	default:
+		if strings.HasPrefix(msg.Type, "command.") {
+			reject(ReasonUnknownCommand, fmt.Errorf("unknown command %s", msg.Type))
+			return
+		}
+		slog.Debug("Unknown message", "type", msg.Type)
+	}
+}
+
+// scanDone replies command.failed to the command.scan msg if its scan failed.
+// A cancelled scan already sent scan.cancelled.
+func (h *Handler) scanDone(msg models.Message, job *scanner.Job, err error) {
+	if errors.Is(err, context.Canceled) {
+		slog.Info("Scan cancelled", "path", job.Path, "scan_id", job.ID)
+		return
+	}
+	if err != nil {
+		slog.Error("Scan failed", "path", job.Path, "error", err)
+		reason := ReasonScanFailed
+		if errors.Is(err, scanner.ErrUnavailable) {
+			reason = ReasonVolumeUnavailable
+		}
+		h.Reply(msg, Failed, reason, err)
+	}
+}
+
+// refuseDeletion answers a command.files.delete while deletion is disabled: every
+// file is reported failed, and the command rejected.
+func (h *Handler) refuseDeletion(msg models.Message) {
+	var deleteCmd models.CommandFilesDeleteData
+	if err := Decode(msg, &deleteCmd); err == nil {
+		results := make([]models.FilesDeleteResultItem, len(deleteCmd.Files))
+		for i, f := range deleteCmd.Files {
+			results[i] = models.FilesDeleteResultItem{
+				MediaFileID: f.MediaFileID,
+				Status:      "failed",
+				Error:       "deletion disabled by watcher config",
+			}
+		}
+		h.publisher.SendEvent("files.delete.completed", models.FilesDeleteCompletedData{
+			RequestID:  deleteCmd.RequestID,
+			DeletionID: deleteCmd.DeletionID,
+			Total:      len(deleteCmd.Files),
+			Deleted:    0,
+			Failed:     len(deleteCmd.Files),
+			Results:    results,
+		})
+		slog.Warn("Deletion disabled — command rejected",
+			"request_id", deleteCmd.RequestID,
+			"deletion_id", deleteCmd.DeletionID,
+			"files", len(deleteCmd.Files),
+		)
+	}
+	h.Reply(msg, Rejected, ReasonDeletionDisabled, errors.New("deletion disabled by watcher config"))
+}
@@ -0,0 +1,287 @@
+package command
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/hash"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
+	"github.com/voclinx/scanarr-watcher/internal/scanner"
+)
+
+type fakeWatcher struct {
+	unavailable bool
+	addErr      error
+	removeErr   error
+}
+
+func (w *fakeWatcher) Available(string) bool   { return !w.unavailable }
+func (w *fakeWatcher) AddPath(string) error    { return w.addErr }
+func (w *fakeWatcher) RemovePath(string) error { return w.removeErr }
+
+type fakeDeleter struct{}
+
+func (fakeDeleter) ProcessDeleteCommand(models.CommandFilesDeleteData)     {}
+func (fakeDeleter) ProcessHardlinkCommand(models.CommandFilesHardlinkData) {}
+
+// newTestHandler creates a Handler recording to rec, with a real scan manager.
+func newTestHandler(t *testing.T) (*Handler, *publisher.Recorder, *fakeWatcher, *scanner.Scanner) {
+	t.Helper()
+	rec := publisher.NewRecorder()
+	s := scanner.New(rec)
+	scans := scanner.NewManager(s)
+	t.Cleanup(scans.Stop)
+	cache, err := hash.OpenCache(filepath.Join(t.TempDir(), "hashes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &fakeWatcher{}
+	return NewHandler(rec, scans, w, fakeDeleter{}, cache), rec, w, s
+}
+
+// reply is a recorded command reply.
+type reply struct {
+	Type string
+	models.CommandReplyData
+}
+
+func repliesOf(rec *publisher.Recorder) []reply {
+	var out []reply
+	for _, e := range rec.Events() {
+		switch e.Type {
+		case Accepted, Rejected, Failed:
+			out = append(out, reply{e.Type, e.Data.(models.CommandReplyData)})
+		}
+	}
+	return out
+}
+
+// waitReply waits until a reply of replyType was recorded and returns it.
+func waitReply(t *testing.T, rec *publisher.Recorder, replyType string) models.CommandReplyData {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if events := rec.EventsOfType(replyType); len(events) > 0 {
+			return events[0].Data.(models.CommandReplyData)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no %s reply", replyType)
+	return models.CommandReplyData{}
+}
+
+func TestHandle_ReplyReasons(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	file := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(h *Handler, w *fakeWatcher)
+		msg   models.Message
+		want  []reply // Type, RequestID and Reason are compared
+	}{
+		{
+			name: "payload not an object",
+			msg:  models.Message{Type: "command.scan", Data: "/mnt/media"},
+			want: []reply{{Rejected, models.CommandReplyData{Reason: ReasonInvalidPayload}}},
+		},
+		{
+			name: "path missing",
+			msg:  models.Message{Type: "command.watch.remove", Data: map[string]interface{}{"request_id": "req-1"}},
+			want: []reply{{Rejected, models.CommandReplyData{RequestID: "req-1", Reason: ReasonInvalidPayload}}},
+		},
+		{
+			name: "unknown command",
+			msg:  models.Message{Type: "command.reboot", Data: map[string]interface{}{"request_id": "req-2"}},
+			want: []reply{{Rejected, models.CommandReplyData{RequestID: "req-2", Reason: ReasonUnknownCommand}}},
+		},
+		{
+			name: "scan of a missing path, correlated by scan_id",
+			msg:  models.Message{Type: "command.scan", Data: map[string]interface{}{"scan_id": "scan-1", "path": missing}},
+			want: []reply{{Rejected, models.CommandReplyData{RequestID: "scan-1", Reason: ReasonPathNotFound}}},
+		},
+		{
+			name: "watch of a file",
+			msg:  models.Message{Type: "command.watch.add", Data: map[string]interface{}{"request_id": "req-3", "path": file}},
+			want: []reply{{Rejected, models.CommandReplyData{RequestID: "req-3", Reason: ReasonPathNotFound}}},
+		},
+		{
+			name:  "deletion disabled",
+			setup: func(h *Handler, _ *fakeWatcher) { h.DeletionDisabled = func() bool { return true } },
+			msg:   models.Message{Type: "command.files.delete", Data: map[string]interface{}{"request_id": "req-4", "deletion_id": "del-1"}},
+			want:  []reply{{Rejected, models.CommandReplyData{RequestID: "req-4", Reason: ReasonDeletionDisabled}}},
+		},
+		{
+			name:  "watch add failed",
+			setup: func(_ *Handler, w *fakeWatcher) { w.addErr = errors.New("too many watches") },
+			msg:   models.Message{Type: "command.watch.add", Data: map[string]interface{}{"request_id": "req-5", "path": dir}},
+			want: []reply{
+				{Accepted, models.CommandReplyData{RequestID: "req-5"}},
+				{Failed, models.CommandReplyData{RequestID: "req-5", Reason: ReasonWatchAddFailed}},
+			},
+		},
+		{
+			name:  "watch remove failed",
+			setup: func(_ *Handler, w *fakeWatcher) { w.removeErr = errors.New("busy") },
+			msg:   models.Message{Type: "command.watch.remove", Data: map[string]interface{}{"request_id": "req-6", "path": dir}},
+			want: []reply{
+				{Accepted, models.CommandReplyData{RequestID: "req-6"}},
+				{Failed, models.CommandReplyData{RequestID: "req-6", Reason: ReasonWatchRemoveFailed}},
+			},
+		},
+		{
+			name:  "scan of an unmounted volume",
+			setup: func(_ *Handler, w *fakeWatcher) { w.unavailable = true },
+			msg:   models.Message{Type: "command.scan", Data: map[string]interface{}{"scan_id": "scan-2", "path": dir}},
+			want:  []reply{{Rejected, models.CommandReplyData{RequestID: "scan-2", Reason: ReasonVolumeUnavailable}}},
+		},
+		{
+			name: "invalidate a missing path",
+			msg:  models.Message{Type: "command.hash_cache.invalidate", Data: map[string]interface{}{"request_id": "req-7", "paths": []string{missing}}},
+			want: []reply{
+				{Accepted, models.CommandReplyData{RequestID: "req-7"}},
+				{Failed, models.CommandReplyData{RequestID: "req-7", Reason: ReasonInvalidateFailed}},
+			},
+		},
+		{
+			name: "cancel of an unknown scan",
+			msg:  models.Message{Type: "command.scan.cancel", Data: map[string]interface{}{"request_id": "req-8", "scan_id": "scan-unknown"}},
+			want: []reply{{Rejected, models.CommandReplyData{RequestID: "req-8", Reason: ReasonScanNotFound}}},
+		},
+		{
+			name: "request_id preferred over scan_id",
+			msg:  models.Message{Type: "command.scan.status", Data: map[string]interface{}{"request_id": "req-9", "scan_id": "scan-3"}},
+			want: []reply{{Accepted, models.CommandReplyData{RequestID: "req-9"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, rec, w, _ := newTestHandler(t)
+			if tt.setup != nil {
+				tt.setup(h, w)
+			}
+			h.Handle(tt.msg)
+
+			got := repliesOf(rec)
+			if len(got) != len(tt.want) {
+				t.Fatalf("replies = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.Type != want.Type || g.RequestID != want.RequestID || g.Reason != want.Reason || g.Command != tt.msg.Type {
+					t.Errorf("reply %d = %s %+v, want %s %+v for %s", i, g.Type, g.CommandReplyData, want.Type, want.CommandReplyData, tt.msg.Type)
+				}
+				if (g.Type == Accepted) != (g.Error == "") {
+					t.Errorf("reply %d: %s with error %q", i, g.Type, g.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestHandle_DeletionDisabledReportsEveryFile(t *testing.T) {
+	h, rec, _, _ := newTestHandler(t)
+	h.DeletionDisabled = func() bool { return true }
+	h.Handle(models.Message{Type: "command.files.delete", Data: models.CommandFilesDeleteData{
+		RequestID:  "req-1",
+		DeletionID: "del-1",
+		Files:      []models.FileDeleteRequest{{MediaFileID: "a"}, {MediaFileID: "b"}},
+	}})
+
+	completed := rec.EventsOfType("files.delete.completed")
+	if len(completed) != 1 {
+		t.Fatalf("got %d files.delete.completed, want 1", len(completed))
+	}
+	if d := completed[0].Data.(models.FilesDeleteCompletedData); d.Failed != 2 || d.Deleted != 0 || d.RequestID != "req-1" {
+		t.Errorf("files.delete.completed = %+v, want 2 failed for req-1", d)
+	}
+}
+
+func TestHandle_ScanFailures(t *testing.T) {
+	h, rec, _, s := newTestHandler(t)
+	dir := t.TempDir()
+
+	// Unmounted once the scan started
+	var mu sync.Mutex
+	checks := 0
+	s.Available = func(string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		checks++
+		return checks == 1
+	}
+	h.Handle(models.Message{Type: "command.scan", Data: map[string]interface{}{"scan_id": "scan-1", "path": dir}})
+	if got := waitReply(t, rec, Failed); got.RequestID != "scan-1" || got.Reason != ReasonVolumeUnavailable {
+		t.Errorf("command.failed = %+v, want scan-1 %s", got, ReasonVolumeUnavailable)
+	}
+
+	// Any other error
+	rec.Reset()
+	msg := models.Message{Type: "command.scan", Data: map[string]interface{}{"request_id": "req-1", "scan_id": "scan-2", "path": dir}}
+	h.scanDone(msg, &scanner.Job{ID: "scan-2", Path: dir}, errors.New("walk failed"))
+	if got := repliesOf(rec); len(got) != 1 || got[0].Type != Failed || got[0].RequestID != "req-1" || got[0].Reason != ReasonScanFailed {
+		t.Errorf("replies = %+v, want command.failed req-1 %s", got, ReasonScanFailed)
+	}
+}
+
+func TestHandle_MergedScanNamesTheQueuedScan(t *testing.T) {
+	h, rec, _, s := newTestHandler(t)
+	dir := t.TempDir()
+
+	// Hold the first scan at its start so the next ones queue behind it
+	gate := make(chan struct{})
+	var once sync.Once
+	s.Available = func(string) bool {
+		once.Do(func() { <-gate })
+		return true
+	}
+	defer close(gate)
+
+	for _, id := range []string{"scan-1", "scan-2", "scan-3"} {
+		h.Handle(models.Message{Type: "command.scan", Data: map[string]interface{}{"scan_id": id, "path": dir}})
+		if id == "scan-1" {
+			deadline := time.Now().Add(2 * time.Second)
+			for len(h.scans.Status()) == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+	}
+
+	got := repliesOf(rec)
+	if len(got) != 3 {
+		t.Fatalf("replies = %+v, want 3", got)
+	}
+	for i, want := range []reply{
+		{Accepted, models.CommandReplyData{RequestID: "scan-1"}},
+		{Accepted, models.CommandReplyData{RequestID: "scan-2"}},
+		{Accepted, models.CommandReplyData{RequestID: "scan-3", ScanID: "scan-2"}},
+	} {
+		if got[i].Type != want.Type || got[i].RequestID != want.RequestID || got[i].ScanID != want.ScanID {
+			t.Errorf("reply %d = %s %+v, want %s %+v", i, got[i].Type, got[i].CommandReplyData, want.Type, want.CommandReplyData)
+		}
+	}
+}
+
+func TestHandle_NoRepliesWithoutCapability(t *testing.T) {
+	h, rec, _, _ := newTestHandler(t)
+	h.RepliesEnabled = func() bool { return false }
+	h.Handle(models.Message{Type: "command.reboot", Data: map[string]interface{}{"request_id": "req-1"}})
+	h.Handle(models.Message{Type: "command.scan.status", Data: map[string]interface{}{"request_id": "req-2"}})
+
+	if got := repliesOf(rec); len(got) != 0 {
+		t.Errorf("replies = %+v, want none", got)
+	}
+	if n := len(rec.EventsOfType("scan.status")); n != 1 {
+		t.Errorf("got %d scan.status, want 1: only replies depend on the capability", n)
+	}
+}
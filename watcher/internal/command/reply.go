@@ -0,0 +1,62 @@
+// Package command handles the commands the API sends to the watcher, and replies
+// to each of them with command.accepted, command.rejected or command.failed.
+package command
+
+import (
+	"encoding/json"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// Reply types.
+const (
+	Accepted = "command.accepted"
+	Rejected = "command.rejected"
+	Failed   = "command.failed"
+)
+
+// Machine-readable reasons sent with command.rejected / command.failed replies.
+const (
+	ReasonInvalidPayload    = "invalid_payload"
+	ReasonUnknownCommand    = "unknown_command"
+	ReasonPathNotFound      = "path_not_found"
+	ReasonDeletionDisabled  = "deletion_disabled"
+	ReasonWatchAddFailed    = "watch_add_failed"
+	ReasonWatchRemoveFailed = "watch_remove_failed"
+	ReasonScanFailed        = "scan_failed"
+	ReasonVolumeUnavailable = "volume_unavailable"
+	ReasonInvalidateFailed  = "invalidate_failed"
+	ReasonScanNotFound      = "scan_not_found"
+)
+
+// NewReply builds the reply to msg, correlated with it by its request_id, or its
+// scan_id for scans.
+func NewReply(msg models.Message, reason string, err error) models.CommandReplyData {
+	var ids struct {
+		RequestID string `json:"request_id"`
+		ScanID    string `json:"scan_id"`
+	}
+	_ = Decode(msg, &ids)
+	if ids.RequestID == "" {
+		ids.RequestID = ids.ScanID
+	}
+
+	reply := models.CommandReplyData{
+		RequestID: ids.RequestID,
+		Command:   msg.Type,
+		Reason:    reason,
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return reply
+}
+
+// Decode decodes the data of a command message into v.
+func Decode(msg models.Message, v interface{}) error {
+	dataBytes, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(dataBytes, v)
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,28 @@ import (
 type EnvConfig struct {
 	WsURL     string
 	WatcherID string
+
+	// SpoolDir is where outbound events are spooled while the API is unreachable.
+	SpoolDir string
+	// SpoolMaxBytes bounds the spool size on disk; a resync scan is triggered if it overflows.
+	SpoolMaxBytes int64
+
+	// CatalogDir keeps the file list of the last scan of each path, for incremental scans.
+	CatalogDir string
+
+	// HashCachePath is where partial hashes are cached across runs; HashCacheMaxEntries bounds it.
+	HashCachePath       string
+	HashCacheMaxEntries int
+
+	// VolumeStatePath records the device each watch path was last seen on, so a
+	// share already unmounted when the watcher starts is not taken for empty.
+	VolumeStatePath string
+
+	// TLS settings for wss:// connections (all optional).
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSPins     []string
 }
 
 // RuntimeConfig holds the dynamic configuration received from the API.
@@ -23,6 +47,14 @@ type RuntimeConfig struct {
 	WsPingIntervalSecs     int
 	LogRetentionDays       int
 	DebugLogRetentionHours int
+	ScanBatchSize          int // 0 = API does not accept scan.files batches
+	ScanBatchFlushMs       int
+	SettleWindowMs         int               // 0 = watcher default
+	WatchModes             map[string]string // watch path → "auto" (default), "native" or "poll"
+	PollIntervalSecs       int               // 0 = watcher default
+	ScanSchedules          map[string]string // path → cron expression ("0 4 * * *", "@daily")
+	ScanHashWorkers        int               // 0 = scanner default
+	ScanHashWorkersPerDev  int               // 0 = no per-device limit
 }
 
 // DefaultRuntimeConfig returns sensible defaults used before config is received from the API.
@@ -50,8 +82,18 @@ func LoadEnv() (*EnvConfig, error) {
 	}
 
 	return &EnvConfig{
-		WsURL:     wsURL,
-		WatcherID: watcherID,
+		WsURL:               wsURL,
+		WatcherID:           watcherID,
+		SpoolDir:            getEnv("SCANARR_SPOOL_DIR", "/var/lib/scanarr-watcher/spool"),
+		SpoolMaxBytes:       int64(getEnvInt("SCANARR_SPOOL_MAX_MB", 512)) * 1024 * 1024,
+		CatalogDir:          getEnv("SCANARR_CATALOG_DIR", "/var/lib/scanarr-watcher/catalog"),
+		HashCachePath:       getEnv("SCANARR_HASH_CACHE_PATH", "/var/lib/scanarr-watcher/hash-cache"),
+		HashCacheMaxEntries: getEnvInt("SCANARR_HASH_CACHE_MAX_ENTRIES", 500000),
+		VolumeStatePath:     getEnv("SCANARR_VOLUME_STATE_PATH", "/var/lib/scanarr-watcher/volumes.json"),
+		TLSCAFile:           getEnv("SCANARR_TLS_CA_FILE", ""),
+		TLSCertFile:         getEnv("SCANARR_TLS_CERT_FILE", ""),
+		TLSKeyFile:          getEnv("SCANARR_TLS_KEY_FILE", ""),
+		TLSPins:             splitList(getEnv("SCANARR_TLS_PIN_SHA256", "")),
 	}, nil
 }
 
@@ -62,6 +104,25 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func getEnvInt(key string, fallback int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || val <= 0 {
+		return fallback
+	}
+	return val
+}
+
 func parseDuration(s, fallback string) time.Duration {
 	d, err := time.ParseDuration(s)
 	if err != nil {
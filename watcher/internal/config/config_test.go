@@ -37,6 +37,59 @@ func TestLoadEnv_DefaultWsURL(t *testing.T) {
 	}
 }
 
+// TestLoadEnv_SpoolDefaults verifies the spool settings fall back to defaults.
+func TestLoadEnv_SpoolDefaults(t *testing.T) {
+	t.Setenv("SCANARR_WATCHER_ID", "my-watcher-id")
+	t.Setenv("SCANARR_SPOOL_DIR", "")
+	t.Setenv("SCANARR_SPOOL_MAX_MB", "not-a-number")
+
+	cfg, err := LoadEnv()
+	if err != nil {
+		t.Fatalf("LoadEnv() returned error: %v", err)
+	}
+
+	if cfg.SpoolDir != "/var/lib/scanarr-watcher/spool" {
+		t.Errorf("SpoolDir default = %q, want %q", cfg.SpoolDir, "/var/lib/scanarr-watcher/spool")
+	}
+	if cfg.SpoolMaxBytes != 512*1024*1024 {
+		t.Errorf("SpoolMaxBytes default = %d, want %d", cfg.SpoolMaxBytes, 512*1024*1024)
+	}
+}
+
+// TestLoadEnv_SpoolOverrides verifies the spool settings can be overridden.
+func TestLoadEnv_SpoolOverrides(t *testing.T) {
+	t.Setenv("SCANARR_WATCHER_ID", "my-watcher-id")
+	t.Setenv("SCANARR_SPOOL_DIR", "/tmp/spool")
+	t.Setenv("SCANARR_SPOOL_MAX_MB", "64")
+
+	cfg, err := LoadEnv()
+	if err != nil {
+		t.Fatalf("LoadEnv() returned error: %v", err)
+	}
+
+	if cfg.SpoolDir != "/tmp/spool" {
+		t.Errorf("SpoolDir = %q, want %q", cfg.SpoolDir, "/tmp/spool")
+	}
+	if cfg.SpoolMaxBytes != 64*1024*1024 {
+		t.Errorf("SpoolMaxBytes = %d, want %d", cfg.SpoolMaxBytes, 64*1024*1024)
+	}
+}
+
+// TestLoadEnv_TLSPins verifies the comma-separated pin list is split and trimmed.
+func TestLoadEnv_TLSPins(t *testing.T) {
+	t.Setenv("SCANARR_WATCHER_ID", "my-watcher-id")
+	t.Setenv("SCANARR_TLS_PIN_SHA256", " pinA= ,pinB=,, ")
+
+	cfg, err := LoadEnv()
+	if err != nil {
+		t.Fatalf("LoadEnv() returned error: %v", err)
+	}
+
+	if len(cfg.TLSPins) != 2 || cfg.TLSPins[0] != "pinA=" || cfg.TLSPins[1] != "pinB=" {
+		t.Errorf("TLSPins = %q, want [pinA= pinB=]", cfg.TLSPins)
+	}
+}
+
 // TestLoadEnv_MissingWatcherID verifies that missing SCANARR_WATCHER_ID returns an error.
 func TestLoadEnv_MissingWatcherID(t *testing.T) {
 	t.Setenv("SCANARR_WS_URL", "ws://localhost:8081/ws/watcher")
@@ -9,17 +9,17 @@ import (
 
 	"github.com/voclinx/scanarr-watcher/internal/filter"
 	"github.com/voclinx/scanarr-watcher/internal/models"
-	"github.com/voclinx/scanarr-watcher/internal/websocket"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
 )
 
 // Deleter handles physical file deletion commands from the API.
 type Deleter struct {
-	wsClient *websocket.Client
+	publisher publisher.EventPublisher
 }
 
 // New creates a new Deleter instance.
-func New(wsClient *websocket.Client) *Deleter {
-	return &Deleter{wsClient: wsClient}
+func New(pub publisher.EventPublisher) *Deleter {
+	return &Deleter{publisher: pub}
 }
 
 // ProcessDeleteCommand processes a command.files.delete from the API.
@@ -43,7 +43,7 @@ func (d *Deleter) ProcessDeleteCommand(cmd models.CommandFilesDeleteData) {
 		totalDirsRemoved += result.DirsRemoved
 
 		// Send per-file progress
-		d.wsClient.SendEvent("files.delete.progress", models.FilesDeleteProgressData{
+		d.publisher.SendEvent("files.delete.progress", models.FilesDeleteProgressData{
 			RequestID:   cmd.RequestID,
 			DeletionID:  cmd.DeletionID,
 			MediaFileID: result.MediaFileID,
@@ -54,7 +54,7 @@ func (d *Deleter) ProcessDeleteCommand(cmd models.CommandFilesDeleteData) {
 	}
 
 	// Send completion summary
-	d.wsClient.SendEvent("files.delete.completed", models.FilesDeleteCompletedData{
+	d.publisher.SendEvent("files.delete.completed", models.FilesDeleteCompletedData{
 		RequestID:   cmd.RequestID,
 		DeletionID:  cmd.DeletionID,
 		Total:       len(cmd.Files),
@@ -182,7 +182,7 @@ func (d *Deleter) CreateHardlink(source, target, volumeRoot string) models.Hardl
 // ProcessHardlinkCommand handles a command.files.hardlink from the API.
 func (d *Deleter) ProcessHardlinkCommand(cmd models.CommandFilesHardlinkData) {
 	result := d.CreateHardlink(cmd.SourcePath, cmd.TargetPath, cmd.VolumePath)
-	d.wsClient.SendEvent("files.hardlink.completed", models.FilesHardlinkCompletedData{
+	d.publisher.SendEvent("files.hardlink.completed", models.FilesHardlinkCompletedData{
 		RequestID:  cmd.RequestID,
 		DeletionID: cmd.DeletionID,
 		Status:     result.Status,
@@ -7,12 +7,13 @@ import (
 	"testing"
 
 	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
 )
 
 // TestDeleteFilePathTraversalBlocked verifies that a file_path containing ../
 // that resolves outside the volume root is rejected.
 func TestDeleteFilePathTraversalBlocked(t *testing.T) {
-	d := &Deleter{wsClient: nil} // wsClient not needed for deleteFile
+	d := &Deleter{publisher: nil} // publisher not needed for deleteFile
 
 	// Create a temp dir structure: volumeRoot/subdir/legit.txt
 	volumeRoot := t.TempDir()
@@ -54,7 +55,7 @@ func TestDeleteFilePathTraversalBlocked(t *testing.T) {
 
 // TestDeleteFilePathTraversalWithDoubleSlash verifies VolumePath + "../../etc/passwd" style attacks.
 func TestDeleteFilePathTraversalWithDoubleSlash(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 
 	volumeRoot := t.TempDir()
 
@@ -75,7 +76,7 @@ func TestDeleteFilePathTraversalWithDoubleSlash(t *testing.T) {
 // TestDeleteFileLegitimatePathSucceeds verifies that a normal file within
 // the volume root can still be deleted.
 func TestDeleteFileLegitimatePathSucceeds(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 
 	volumeRoot := t.TempDir()
 	movieDir := filepath.Join(volumeRoot, "Movie (2024)")
@@ -115,7 +116,7 @@ func TestDeleteFileLegitimatePathSucceeds(t *testing.T) {
 
 // TestDeleteFileSizeCaptured verifies that the file size is reported in the result.
 func TestDeleteFileSizeCaptured(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 
 	volumeRoot := t.TempDir()
 	content := make([]byte, 4096)
@@ -140,7 +141,7 @@ func TestDeleteFileSizeCaptured(t *testing.T) {
 
 // TestCreateHardlinkSuccess verifies that a hardlink is created and shares the same inode.
 func TestCreateHardlinkSuccess(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 	volumeRoot := t.TempDir()
 
 	srcFile := filepath.Join(volumeRoot, "src", "source.mkv")
@@ -173,7 +174,7 @@ func TestCreateHardlinkSuccess(t *testing.T) {
 
 // TestCreateHardlinkSourceNotFound verifies that a missing source file returns "failed".
 func TestCreateHardlinkSourceNotFound(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 	volumeRoot := t.TempDir()
 
 	result := d.CreateHardlink(
@@ -189,7 +190,7 @@ func TestCreateHardlinkSourceNotFound(t *testing.T) {
 
 // TestCreateHardlinkPathTraversalSource verifies that a source outside the volume root is rejected.
 func TestCreateHardlinkPathTraversalSource(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 	volumeRoot := t.TempDir()
 	outsideDir := t.TempDir()
 	outsideFile := filepath.Join(outsideDir, "secret.mkv")
@@ -206,7 +207,7 @@ func TestCreateHardlinkPathTraversalSource(t *testing.T) {
 
 // TestCreateHardlinkTargetAlreadyExists verifies that an existing target is replaced by the hardlink.
 func TestCreateHardlinkTargetAlreadyExists(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 	volumeRoot := t.TempDir()
 	srcFile := filepath.Join(volumeRoot, "source.mkv")
 	tgtFile := filepath.Join(volumeRoot, "target.mkv")
@@ -231,7 +232,7 @@ func TestCreateHardlinkTargetAlreadyExists(t *testing.T) {
 
 // TestDeleteFileVolumeRootNotDeleted ensures cleanupEmptyDirs never removes the volume root.
 func TestDeleteFileVolumeRootNotDeleted(t *testing.T) {
-	d := &Deleter{wsClient: nil}
+	d := &Deleter{publisher: nil}
 
 	volumeRoot := t.TempDir()
 	// File directly in volumeRoot (no subdirectory)
@@ -258,3 +259,41 @@ func TestDeleteFileVolumeRootNotDeleted(t *testing.T) {
 		t.Errorf("expected 0 dirs removed, got %d", result.DirsRemoved)
 	}
 }
+
+// TestProcessDeleteCommand_ReportsProgressAndCompletion verifies the events emitted
+// for a delete command, using an in-memory publisher.
+func TestProcessDeleteCommand_ReportsProgressAndCompletion(t *testing.T) {
+	rec := publisher.NewRecorder()
+	d := New(rec)
+
+	volumeRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(volumeRoot, "a.mkv"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d.ProcessDeleteCommand(models.CommandFilesDeleteData{
+		RequestID:  "req-1",
+		DeletionID: "del-1",
+		Files: []models.FileDeleteRequest{
+			{MediaFileID: "file-a", VolumePath: volumeRoot, FilePath: "a.mkv"},
+			{MediaFileID: "file-b", VolumePath: volumeRoot, FilePath: "../escape.mkv"},
+		},
+	})
+
+	progress := rec.EventsOfType("files.delete.progress")
+	if len(progress) != 2 {
+		t.Fatalf("files.delete.progress count = %d, want 2", len(progress))
+	}
+
+	completed := rec.EventsOfType("files.delete.completed")
+	if len(completed) != 1 {
+		t.Fatalf("files.delete.completed count = %d, want 1", len(completed))
+	}
+	summary, ok := completed[0].Data.(models.FilesDeleteCompletedData)
+	if !ok {
+		t.Fatalf("completed data type = %T, want FilesDeleteCompletedData", completed[0].Data)
+	}
+	if summary.Deleted != 1 || summary.Failed != 1 {
+		t.Errorf("summary deleted=%d failed=%d, want 1 and 1", summary.Deleted, summary.Failed)
+	}
+}
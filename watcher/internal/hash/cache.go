@@ -0,0 +1,322 @@
+package hash
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/fsutil"
+)
+
+// DefaultCacheMaxEntries bounds the cache when no limit is given (~45 MB in memory).
+const DefaultCacheMaxEntries = 500000
+
+// DefaultCacheMaxAge is how long an entry is kept without being used.
+const DefaultCacheMaxAge = 90 * 24 * time.Hour
+
+// cacheMagic starts every cache file; cacheVersion changes with the record layout
+// or the hash algorithm, and a file of another version is discarded.
+const (
+	cacheMagic   = "SCHC"
+	cacheVersion = 1
+	recordSize   = 5*8 + sumSize
+	sumSize      = 32 // SHA-256
+)
+
+// Key identifies the content of a file: the same inode with the same size and
+// mtime is presumed unchanged.
+type Key struct {
+	Dev, Ino  uint64
+	Size      int64
+	ModTimeNs int64
+}
+
+// keyOf returns the cache key of a stat result. False if the platform has no inode.
+func keyOf(info os.FileInfo) (Key, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Key{}, false
+	}
+	return Key{Dev: uint64(st.Dev), Ino: st.Ino, Size: info.Size(), ModTimeNs: info.ModTime().UnixNano()}, true
+}
+
+type cacheEntry struct {
+	sum  [sumSize]byte
+	used int64 // unix seconds of the last lookup or store
+}
+
+// Cache remembers partial hashes across scans, live events and restarts, so an
+// unchanged file is never read again to be hashed. Entries are evicted least
+// recently used first beyond the entry limit, and when unused for the maximum
+// age. Entries are kept in memory and written to disk by Save.
+//
+// A nil *Cache hashes every file.
+type Cache struct {
+	mu         sync.Mutex
+	path       string
+	entries    map[Key]cacheEntry
+	maxEntries int
+	maxAge     time.Duration
+	dirty      bool
+
+	now func() time.Time
+}
+
+// OpenCache loads the cache kept at path, holding at most maxEntries entries
+// (<= 0 for DefaultCacheMaxEntries). A missing, corrupt or outdated file starts
+// an empty cache.
+func OpenCache(path string, maxEntries int) (*Cache, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		path:       path,
+		entries:    make(map[Key]cacheEntry),
+		maxEntries: maxEntries,
+		maxAge:     DefaultCacheMaxAge,
+		now:        time.Now,
+	}
+	if err := c.load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Discarding unreadable hash cache", "path", path, "error", err)
+		c.entries = make(map[Key]cacheEntry)
+	}
+	return c, nil
+}
+
+// Calculate returns the partial hash of filePath, from the cache if the file is
+// unchanged since it was last hashed.
+func (c *Cache) Calculate(filePath string) (string, error) {
+	if c == nil {
+		return Calculate(filePath)
+	}
+	before, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	key, ok := keyOf(before)
+	if !ok {
+		return Calculate(filePath)
+	}
+	if sum, ok := c.lookup(key); ok {
+		return sum, nil
+	}
+
+	sum, err := Calculate(filePath)
+	if err != nil {
+		return "", err
+	}
+	// Only cache a hash of content that did not change while it was read
+	if after, err := os.Stat(filePath); err == nil {
+		if k, ok := keyOf(after); ok && k == key {
+			c.store(key, sum)
+		}
+	}
+	return sum, nil
+}
+
+func (c *Cache) lookup(key Key) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if now := c.now().Unix(); e.used != now {
+		e.used = now
+		c.entries[key] = e
+		c.dirty = true
+	}
+	return hex.EncodeToString(e.sum[:]), true
+}
+
+func (c *Cache) store(key Key, sum string) {
+	var e cacheEntry
+	if n, err := hex.Decode(e.sum[:], []byte(sum)); err != nil || n != sumSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.used = c.now().Unix()
+	c.entries[key] = e
+	c.dirty = true
+	if len(c.entries) > c.maxEntries {
+		// Evict in bulk rather than one entry per store
+		c.evictLocked(c.maxEntries * 9 / 10)
+	}
+}
+
+// evictLocked drops the least recently used entries down to keep. Called with c.mu held.
+func (c *Cache) evictLocked(keep int) {
+	if len(c.entries) <= keep {
+		return
+	}
+	type aged struct {
+		key  Key
+		used int64
+	}
+	all := make([]aged, 0, len(c.entries))
+	for k, e := range c.entries {
+		all = append(all, aged{k, e.used})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].used < all[j].used })
+	for _, a := range all[:len(all)-keep] {
+		delete(c.entries, a.key)
+	}
+	c.dirty = true
+}
+
+// Invalidate drops the entries of the file at path, or of every file below it if
+// it is a directory, and returns how many were dropped. Use it when content was
+// rewritten with its size and mtime preserved.
+func (c *Cache) Invalidate(path string) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	dropped := 0
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == path {
+				return err
+			}
+			return nil // keep going through the rest of the tree
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if key, ok := keyOf(info); ok {
+			c.mu.Lock()
+			if _, ok := c.entries[key]; ok {
+				delete(c.entries, key)
+				c.dirty = true
+				dropped++
+			}
+			c.mu.Unlock()
+		}
+		return nil
+	})
+	return dropped, err
+}
+
+// Purge drops every entry and returns how many there were.
+func (c *Cache) Purge() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[Key]cacheEntry)
+	c.dirty = true
+	return n
+}
+
+// Len returns the number of cached hashes.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save drops entries unused for the maximum age and writes the cache to disk if
+// it changed since the last save. The file is replaced atomically.
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	cutoff := c.now().Add(-c.maxAge).Unix()
+	for k, e := range c.entries {
+		if e.used < cutoff {
+			delete(c.entries, k)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	buf := make([]byte, 0, 16+len(c.entries)*recordSize)
+	buf = append(buf, cacheMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, cacheVersion)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(c.entries)))
+	for k, e := range c.entries {
+		buf = binary.LittleEndian.AppendUint64(buf, k.Dev)
+		buf = binary.LittleEndian.AppendUint64(buf, k.Ino)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(k.Size))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(k.ModTimeNs))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.used))
+		buf = append(buf, e.sum[:]...)
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	if err := fsutil.WriteFileAtomic(c.path, buf); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// load reads the cache file into c.entries.
+func (c *Cache) load() error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(cacheMagic)+4+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if string(header[:len(cacheMagic)]) != cacheMagic {
+		return errors.New("not a hash cache file")
+	}
+	if v := binary.LittleEndian.Uint32(header[len(cacheMagic):]); v != cacheVersion {
+		return fmt.Errorf("hash cache version %d, want %d", v, cacheVersion)
+	}
+	count := binary.LittleEndian.Uint64(header[len(cacheMagic)+4:])
+
+	rec := make([]byte, recordSize)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return err
+		}
+		k := Key{
+			Dev:       binary.LittleEndian.Uint64(rec[0:]),
+			Ino:       binary.LittleEndian.Uint64(rec[8:]),
+			Size:      int64(binary.LittleEndian.Uint64(rec[16:])),
+			ModTimeNs: int64(binary.LittleEndian.Uint64(rec[24:])),
+		}
+		e := cacheEntry{used: int64(binary.LittleEndian.Uint64(rec[32:]))}
+		copy(e.sum[:], rec[40:])
+		c.entries[k] = e
+	}
+	c.evictLocked(c.maxEntries)
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,161 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rewrite replaces the content of path with the same number of bytes and
+// restores its mtime, the change the cache cannot see.
+func rewrite(t *testing.T, path string, b byte) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, info.Size())
+	for i := range content {
+		content[i] = b
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCache_HitsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(file, []byte("original content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenCache(filepath.Join(dir, "cache", "hashes"), 0)
+	if err != nil {
+		t.Fatalf("OpenCache: %v", err)
+	}
+
+	first, err := c.Calculate(file)
+	if err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", c.Len())
+	}
+
+	// Same inode, size and mtime: served from the cache without reading the file
+	rewrite(t, file, 'x')
+	if got, _ := c.Calculate(file); got != first {
+		t.Errorf("Calculate after an invisible rewrite = %s, want cached %s", got, first)
+	}
+
+	// Invalidated: hashed again
+	if n, err := c.Invalidate(dir); err != nil || n != 1 {
+		t.Fatalf("Invalidate = %d, %v, want 1 entry dropped", n, err)
+	}
+	fresh, _ := Calculate(file)
+	if got, _ := c.Calculate(file); got != fresh || got == first {
+		t.Errorf("Calculate after Invalidate = %s, want fresh %s", got, fresh)
+	}
+
+	// A visible change (mtime) misses the cache
+	later := time.Now().Add(time.Hour)
+	rewrite(t, file, 'y')
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Calculate(file)
+	if got, _ := c.Calculate(file); got != want {
+		t.Errorf("Calculate after a write = %s, want %s", got, want)
+	}
+}
+
+func TestCache_SaveAndReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hashes")
+	c, err := OpenCache(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for i := 0; i < 3; i++ {
+		f := filepath.Join(dir, fmt.Sprintf("f%d.mkv", i))
+		if err := os.WriteFile(f, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Calculate(f); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reopened, err := OpenCache(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 3 {
+		t.Fatalf("reloaded Len = %d, want 3", reopened.Len())
+	}
+	want, _ := c.Calculate(files[0])
+	rewrite(t, files[0], 'z')
+	if got, _ := reopened.Calculate(files[0]); got != want {
+		t.Errorf("reloaded cache returned %s, want %s", got, want)
+	}
+
+	// A corrupt file starts an empty cache
+	if err := os.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := OpenCache(path, 0); err != nil || c.Len() != 0 {
+		t.Errorf("OpenCache of a corrupt file = %v entries, %v; want an empty cache", c.Len(), err)
+	}
+}
+
+func TestCache_Eviction(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenCache(filepath.Join(dir, "hashes"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Now()
+	c.now = func() time.Time { return clock }
+
+	var sum [sumSize]byte
+	sumHex := fmt.Sprintf("%x", sum)
+	for i := 0; i < 11; i++ {
+		clock = clock.Add(time.Second)
+		c.store(Key{Ino: uint64(i)}, sumHex)
+	}
+	// Over the limit: the least recently used are dropped down to 90%
+	if c.Len() != 9 {
+		t.Fatalf("Len = %d, want 9", c.Len())
+	}
+	if _, ok := c.lookup(Key{Ino: 0}); ok {
+		t.Error("oldest entry survived eviction")
+	}
+	if _, ok := c.lookup(Key{Ino: 10}); !ok {
+		t.Error("newest entry was evicted")
+	}
+
+	// Unused for the maximum age: dropped at save
+	clock = clock.Add(DefaultCacheMaxAge - time.Second)
+	c.lookup(Key{Ino: 5})
+	clock = clock.Add(2 * time.Second)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len after save = %d, want 1 (only the entry used recently)", c.Len())
+	}
+
+	if n := c.Purge(); n != 1 || c.Len() != 0 {
+		t.Errorf("Purge = %d, Len = %d; want 1, 0", n, c.Len())
+	}
+}
@@ -3,6 +3,9 @@ package models
 import "time"
 
 // Message is the base WebSocket message format.
+// Outbound events also carry "boot_id" and "seq", the watcher's per-boot ID and a
+// monotonic sequence number stamped when they are written (see websocket.stampSeq),
+// so the API can detect gaps and acknowledge what it received (watcher.ack).
 type Message struct {
 	Type      string      `json:"type"`
 	Timestamp time.Time   `json:"timestamp"`
@@ -53,6 +56,7 @@ type FileModifiedData struct {
 type ScanStartedData struct {
 	Path   string `json:"path"`
 	ScanID string `json:"scan_id"`
+	Mode   string `json:"mode,omitempty"` // "full" (scan.file for every file) or "incremental"
 }
 
 // ScanProgressData represents a scan.progress event.
@@ -76,6 +80,22 @@ type ScanFileData struct {
 	PartialHash   string    `json:"partial_hash"`
 }
 
+// ScanRemovedData represents a scan.removed event: a file seen by the previous
+// scan of the path and gone since. Only sent by incremental scans.
+type ScanRemovedData struct {
+	ScanID   string `json:"scan_id"`
+	Path     string `json:"path"`
+	Inode    uint64 `json:"inode"`
+	DeviceID uint64 `json:"device_id"`
+}
+
+// ScanFilesData represents a scan.files event: a batch of scan.file entries.
+// Only sent when the API enabled batching via scan_batch_size in watcher.config.
+type ScanFilesData struct {
+	ScanID string         `json:"scan_id"`
+	Files  []ScanFileData `json:"files"`
+}
+
 // ScanCompletedData represents a scan.completed event.
 type ScanCompletedData struct {
 	ScanID         string `json:"scan_id"`
@@ -86,26 +106,104 @@ type ScanCompletedData struct {
 	DiskTotalBytes int64  `json:"disk_total_bytes"`
 	DiskFreeBytes  int64  `json:"disk_free_bytes"`
 	DurationMs     int64  `json:"duration_ms"`
+	// Throughput: files and bytes of files scanned per second, with the hashing concurrency used
+	FilesPerSecond float64 `json:"files_per_second"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	HashWorkers    int     `json:"hash_workers"`
+	Mode           string  `json:"mode,omitempty"`
+	// Changes summarizes an incremental scan; nil for a full scan.
+	Changes *ScanChangesData `json:"changes,omitempty"`
+}
+
+// ScanCancelledData represents a scan.cancelled event, sent instead of
+// scan.completed for a scan stopped by command.scan.cancel or shutdown.
+type ScanCancelledData struct {
+	ScanID       string `json:"scan_id"`
+	Path         string `json:"path"`
+	FilesScanned int    `json:"files_scanned"`
+}
+
+// ScanChangesData counts the files an incremental scan found added, changed,
+// removed and unchanged since the previous scan of the path.
+type ScanChangesData struct {
+	Added     int `json:"added"`
+	Changed   int `json:"changed"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
 }
 
 // WatcherStatusData represents a watcher.status event.
 type WatcherStatusData struct {
-	Status        string   `json:"status"`
-	WatcherID     string   `json:"watcher_id"`
-	ConfigHash    string   `json:"config_hash"`
-	WatchedPaths  []string `json:"watched_paths"`
-	UptimeSeconds int64    `json:"uptime_seconds"`
+	Status          string            `json:"status"`
+	ConnectionState string            `json:"connection_state"` // lifecycle state of the API connection
+	WatcherID       string            `json:"watcher_id"`
+	ConfigHash      string            `json:"config_hash"`
+	WatchedPaths    []string          `json:"watched_paths"`
+	UptimeSeconds   int64             `json:"uptime_seconds"`
+	QueueDepths     map[string]int    `json:"queue_depths,omitempty"` // pending events per outbound lane
+	QueueDrops      map[string]uint64 `json:"queue_drops,omitempty"`  // events dropped per lane since startup
 }
 
 // CommandScanData represents a command.scan message from the API.
 type CommandScanData struct {
-	Path   string `json:"path"`
-	ScanID string `json:"scan_id"`
+	RequestID string `json:"request_id,omitempty"`
+	Path      string `json:"path"`
+	ScanID    string `json:"scan_id"`
+	Mode      string `json:"mode,omitempty"` // "full" (default) or "incremental"
+}
+
+// CommandScanCancelData represents a command.scan.cancel message: cancel the
+// scan ScanID, or every scan of Path if ScanID is empty.
+type CommandScanCancelData struct {
+	RequestID string `json:"request_id,omitempty"`
+	ScanID    string `json:"scan_id,omitempty"`
+	Path      string `json:"path,omitempty"`
+}
+
+// CommandScanStatusData represents a command.scan.status message, answered with scan.status.
+type CommandScanStatusData struct {
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ScanStatusData represents a scan.status event: the running and queued scans.
+type ScanStatusData struct {
+	RequestID string           `json:"request_id,omitempty"`
+	Scans     []ScanStatusItem `json:"scans"`
+}
+
+// ScanStatusItem is one scan in scan.status.
+type ScanStatusItem struct {
+	ScanID       string     `json:"scan_id"`
+	Path         string     `json:"path"`
+	Mode         string     `json:"mode"`
+	State        string     `json:"state"`                // "running" or "queued"
+	StartedAt    *time.Time `json:"started_at,omitempty"` // running scans only
+	FilesScanned int        `json:"files_scanned"`
+	DirsScanned  int        `json:"dirs_scanned"`
 }
 
 // CommandWatchData represents a command.watch.add or command.watch.remove message.
 type CommandWatchData struct {
-	Path string `json:"path"`
+	RequestID string `json:"request_id,omitempty"`
+	Path      string `json:"path"`
+}
+
+// CommandHashCacheInvalidateData represents a command.hash_cache.invalidate
+// message: drop the cached hashes of the files at or below Paths, or of every
+// file if Paths is empty.
+type CommandHashCacheInvalidateData struct {
+	RequestID string   `json:"request_id,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+}
+
+// CommandReplyData — sent by the watcher for every command received, as
+// command.accepted, command.rejected (not started) or command.failed (started, then failed).
+type CommandReplyData struct {
+	RequestID string `json:"request_id"`        // request_id of the command (scan_id for command.scan without one)
+	Command   string `json:"command"`           // type of the command being answered
+	Reason    string `json:"reason,omitempty"`  // machine-readable reason, e.g. "path_not_found"
+	Error     string `json:"error,omitempty"`   // human-readable detail
+	ScanID    string `json:"scan_id,omitempty"` // command.scan merged into this already queued scan
 }
 
 // ──────────────────────────────────────────────
@@ -192,10 +290,16 @@ type FilesHardlinkCompletedData struct {
 // ──────────────────────────────────────────────
 
 // WatcherHelloData — sent by watcher on first connection.
+// ProtocolVersion, Capabilities and HashAlgorithms announce what the watcher supports;
+// the API pins what both sides will use in WatcherConfigData.
 type WatcherHelloData struct {
-	WatcherID string `json:"watcher_id"`
-	Hostname  string `json:"hostname"`
-	Version   string `json:"version"`
+	WatcherID       string   `json:"watcher_id"`
+	Hostname        string   `json:"hostname"`
+	Version         string   `json:"version"`
+	BootID          string   `json:"boot_id"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+	HashAlgorithms  []string `json:"hash_algorithms"`
 }
 
 // WatcherAuthData — sent by watcher to authenticate with its token.
@@ -206,16 +310,29 @@ type WatcherAuthData struct {
 // WatcherConfigData — sent by the API to the watcher after authentication.
 // Contains all runtime configuration fields.
 type WatcherConfigData struct {
-	WatchPaths             []string `json:"watch_paths"`
-	ScanOnStart            bool     `json:"scan_on_start"`
-	LogLevel               string   `json:"log_level"`
-	DisableDeletion        bool     `json:"disable_deletion"`
-	WsReconnectDelaySecs   int      `json:"ws_reconnect_delay_seconds"`
-	WsPingIntervalSecs     int      `json:"ws_ping_interval_seconds"`
-	LogRetentionDays       int      `json:"log_retention_days"`
-	DebugLogRetentionHours int      `json:"debug_log_retention_hours"`
-	ConfigHash             string   `json:"config_hash"`
-	AuthToken              string   `json:"auth_token,omitempty"` // only set on initial approval
+	WatchPaths             []string          `json:"watch_paths"`
+	ScanOnStart            bool              `json:"scan_on_start"`
+	LogLevel               string            `json:"log_level"`
+	DisableDeletion        bool              `json:"disable_deletion"`
+	WsReconnectDelaySecs   int               `json:"ws_reconnect_delay_seconds"`
+	WsPingIntervalSecs     int               `json:"ws_ping_interval_seconds"`
+	LogRetentionDays       int               `json:"log_retention_days"`
+	DebugLogRetentionHours int               `json:"debug_log_retention_hours"`
+	ScanBatchSize          int               `json:"scan_batch_size,omitempty"`              // > 1 if the API accepts scan.files
+	ScanBatchFlushMs       int               `json:"scan_batch_flush_ms,omitempty"`          // max delay before a partial batch is sent
+	SettleWindowMs         int               `json:"settle_window_ms,omitempty"`             // quiet time before a written file is reported
+	WatchModes             map[string]string `json:"watch_modes,omitempty"`                  // watch path → "auto", "native" or "poll"
+	PollIntervalSecs       int               `json:"poll_interval_seconds,omitempty"`        // listing interval of polled paths
+	ScanSchedules          map[string]string `json:"scan_schedules,omitempty"`               // path → cron expression of its reconciliation scans
+	ScanHashWorkers        int               `json:"scan_hash_workers,omitempty"`            // files hashed at once by a scan
+	ScanHashWorkersPerDev  int               `json:"scan_hash_workers_per_device,omitempty"` // of which at most this many on one device
+	ConfigHash             string            `json:"config_hash"`
+	AuthToken              string            `json:"auth_token,omitempty"` // only set on initial approval
+
+	// Negotiated protocol. ProtocolVersion is 0 for APIs that predate negotiation.
+	ProtocolVersion int      `json:"protocol_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`   // subset of the hello capabilities both sides use
+	HashAlgorithm   string   `json:"hash_algorithm,omitempty"` // one of the hello hash algorithms
 }
 
 // WatcherConfigHashData — sent by the API to notify the watcher of a config change.
@@ -223,6 +340,36 @@ type WatcherConfigHashData struct {
 	ConfigHash string `json:"config_hash"`
 }
 
+// WatcherAckData — sent by the API to acknowledge events.
+// Acks are cumulative: every event of BootID with a sequence <= Seq has been received.
+type WatcherAckData struct {
+	BootID string `json:"boot_id"`
+	Seq    uint64 `json:"seq"`
+}
+
+// WatcherReplayData — sent by the API to request a resend of events from FromSeq onwards.
+type WatcherReplayData struct {
+	BootID  string `json:"boot_id"`
+	FromSeq uint64 `json:"from_seq"`
+}
+
+// WatcherOverflowData — sent by the watcher when the kernel event queue overflowed.
+// Changes under Paths may have been missed; each is rescanned with the scan ID at
+// the same index, so the API reconciles them from the scan that follows.
+type WatcherOverflowData struct {
+	Paths   []string `json:"paths"`
+	ScanIDs []string `json:"scan_ids"`
+}
+
+// VolumeData represents a volume.unavailable or volume.available event: the
+// filesystem holding a watch path went away (unmounted, unreadable) or came back.
+// No file.deleted is sent and no scan runs for the path while it is unavailable.
+type VolumeData struct {
+	Path     string `json:"path"`
+	DeviceID uint64 `json:"device_id,omitempty"` // device now holding the path, on volume.available
+	Reason   string `json:"reason,omitempty"`    // why it is unavailable
+}
+
 // WatcherLogData — sent by the watcher to forward a log entry to the API.
 type WatcherLogData struct {
 	Level     string                 `json:"level"`
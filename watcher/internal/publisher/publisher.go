@@ -0,0 +1,11 @@
+package publisher
+
+// EventPublisher is what the scanner, watcher and deleter need to report to the API.
+// Implemented by websocket.Client in production and by Recorder in tests.
+type EventPublisher interface {
+	// SendEvent queues an event of the given type with the current timestamp.
+	SendEvent(eventType string, data interface{})
+
+	// ForwardLog sends a log entry to the API as a watcher.log message.
+	ForwardLog(level, message string, context map[string]interface{})
+}
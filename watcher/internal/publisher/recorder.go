@@ -0,0 +1,85 @@
+package publisher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// LogEntry is a log entry captured by Recorder.ForwardLog.
+type LogEntry struct {
+	Level   string
+	Message string
+	Context map[string]interface{}
+}
+
+// Recorder is an in-memory EventPublisher that records everything it is given.
+// It lets components be exercised without a WebSocket connection.
+type Recorder struct {
+	mu     sync.Mutex
+	events []models.Message
+	logs   []LogEntry
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// SendEvent records the event.
+func (r *Recorder) SendEvent(eventType string, data interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, models.Message{
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	})
+}
+
+// ForwardLog records the log entry.
+func (r *Recorder) ForwardLog(level, message string, context map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, LogEntry{Level: level, Message: message, Context: context})
+}
+
+// Events returns a copy of all recorded events, in order.
+func (r *Recorder) Events() []models.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]models.Message, len(r.events))
+	copy(out, r.events)
+	return out
+}
+
+// EventsOfType returns the recorded events with the given type, in order.
+func (r *Recorder) EventsOfType(eventType string) []models.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.Message
+	for _, e := range r.events {
+		if e.Type == eventType {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Logs returns a copy of all recorded log entries, in order.
+func (r *Recorder) Logs() []LogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]LogEntry, len(r.logs))
+	copy(out, r.logs)
+	return out
+}
+
+// Reset discards everything recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+	r.logs = nil
+}
@@ -0,0 +1,50 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// TestRecorder_RecordsEventsInOrder verifies events are captured with their type and data.
+func TestRecorder_RecordsEventsInOrder(t *testing.T) {
+	r := NewRecorder()
+	r.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/a.mkv"})
+	r.SendEvent("file.deleted", models.FileDeletedData{Path: "/mnt/b.mkv"})
+	r.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/c.mkv"})
+
+	events := r.Events()
+	if len(events) != 3 {
+		t.Fatalf("Events() len = %d, want 3", len(events))
+	}
+	if events[1].Type != "file.deleted" {
+		t.Errorf("events[1].Type = %q, want %q", events[1].Type, "file.deleted")
+	}
+	if events[0].Timestamp.IsZero() {
+		t.Error("event timestamp is zero, want non-zero")
+	}
+
+	created := r.EventsOfType("file.created")
+	if len(created) != 2 {
+		t.Fatalf("EventsOfType(file.created) len = %d, want 2", len(created))
+	}
+	if data, ok := created[1].Data.(models.FileCreatedData); !ok || data.Path != "/mnt/c.mkv" {
+		t.Errorf("created[1].Data = %#v, want FileCreatedData for /mnt/c.mkv", created[1].Data)
+	}
+}
+
+// TestRecorder_LogsAndReset verifies log capture and Reset.
+func TestRecorder_LogsAndReset(t *testing.T) {
+	r := NewRecorder()
+	r.ForwardLog("warn", "something happened", map[string]interface{}{"path": "/mnt"})
+
+	logs := r.Logs()
+	if len(logs) != 1 || logs[0].Level != "warn" || logs[0].Message != "something happened" {
+		t.Errorf("Logs() = %+v, want one warn entry", logs)
+	}
+
+	r.Reset()
+	if len(r.Events()) != 0 || len(r.Logs()) != 0 {
+		t.Error("Reset() did not clear recorded events and logs")
+	}
+}
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/fsutil"
+)
+
+// catalogEntry is what a scan recorded about one file.
+type catalogEntry struct {
+	DeviceID uint64 `json:"dev"`
+	Inode    uint64 `json:"ino"`
+	Nlink    uint64 `json:"nlink"`
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mtime_ns"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// unchanged reports whether e and cur describe the same, unmodified file.
+func (e catalogEntry) unchanged(cur catalogEntry) bool {
+	return e.DeviceID == cur.DeviceID && e.Inode == cur.Inode && e.Nlink == cur.Nlink &&
+		e.Size == cur.Size && e.ModTime == cur.ModTime
+}
+
+// catalog is the file list of the last completed scan of a path.
+type catalog struct {
+	Path      string                  `json:"path"`
+	ScannedAt time.Time               `json:"scanned_at"`
+	Files     map[string]catalogEntry `json:"files"` // file path → entry
+}
+
+func newCatalog(path string) *catalog {
+	return &catalog{Path: path, Files: make(map[string]catalogEntry)}
+}
+
+// catalogFile returns where the catalog of path is kept in dir.
+func catalogFile(dir, path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCatalog reads the catalog of path from dir. Returns nil, nil if there is none.
+func loadCatalog(dir, path string) (*catalog, error) {
+	data, err := os.ReadFile(catalogFile(dir, path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var c catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Path != path {
+		// Hash collision: not ours
+		return nil, nil
+	}
+	if c.Files == nil {
+		c.Files = make(map[string]catalogEntry)
+	}
+	return &c, nil
+}
+
+// save writes the catalog to dir, replacing the previous one atomically.
+func (c *catalog) save(dir string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(catalogFile(dir, c.Path), data)
+}
@@ -0,0 +1,232 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// Scan states reported by command.scan.status.
+const (
+	StateQueued  = "queued"
+	StateRunning = "running"
+)
+
+// Job is a scan requested from a Manager.
+type Job struct {
+	ID   string
+	Path string
+
+	mode    string // may be raised to ModeFull while queued; guarded by Manager.mu
+	state   string
+	started time.Time
+	cancel  context.CancelFunc
+	ctx     context.Context
+
+	done chan struct{}
+	err  error
+}
+
+// Wait blocks until the scan is over and returns its error: context.Canceled if
+// it was cancelled, whether before or after it started.
+func (j *Job) Wait() error {
+	<-j.done
+	return j.err
+}
+
+// Manager runs the scans of the watcher, one at a time per path. A scan requested
+// while the path is being scanned is queued behind it; requests arriving while
+// one is already queued are merged into it, since it has not started yet and
+// will see everything they would.
+type Manager struct {
+	scanner *Scanner
+
+	mu      sync.Mutex
+	running map[string]*Job // path → scan in progress
+	queued  map[string]*Job // path → scan waiting for the running one
+	stopped bool
+}
+
+// NewManager creates a Manager running scans with s.
+func NewManager(s *Scanner) *Manager {
+	return &Manager{
+		scanner: s,
+		running: make(map[string]*Job),
+		queued:  make(map[string]*Job),
+	}
+}
+
+// Submit requests a scan of path in the given mode and returns the job that will
+// do it. merged is true if the request joined a queued scan, whose ID differs from
+// scanID; a full request makes the queued scan full.
+func (m *Manager) Submit(path, scanID, mode string) (job *Job, merged bool) {
+	key := filepath.Clean(path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if q, ok := m.queued[key]; ok {
+		if mode != ModeIncremental {
+			q.mode = ModeFull
+		}
+		slog.Info("Scan request merged into a queued scan", "path", path, "scan_id", scanID, "queued_scan_id", q.ID)
+		return q, true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job = &Job{ID: scanID, Path: path, mode: mode, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	if m.stopped {
+		cancel()
+		job.err = context.Canceled
+		close(job.done)
+		return job, false
+	}
+	if _, ok := m.running[key]; ok {
+		job.state = StateQueued
+		m.queued[key] = job
+		slog.Info("Scan queued behind the running scan of the path", "path", path, "scan_id", scanID)
+		return job, false
+	}
+	m.startLocked(key, job)
+	return job, false
+}
+
+// startLocked runs job. Called with m.mu held.
+func (m *Manager) startLocked(key string, job *Job) {
+	job.state = StateRunning
+	job.started = time.Now()
+	m.running[key] = job
+	mode := job.mode
+	go func() {
+		err := m.scanner.ScanContext(job.ctx, job.Path, job.ID, mode)
+		m.finish(key, job, err)
+	}()
+}
+
+// finish records the end of a running job and starts the scan queued behind it.
+func (m *Manager) finish(key string, job *Job, err error) {
+	job.cancel()
+
+	m.mu.Lock()
+	if m.running[key] == job {
+		delete(m.running, key)
+	}
+	job.err = err
+	close(job.done)
+	if q, ok := m.queued[key]; ok && !m.stopped {
+		delete(m.queued, key)
+		m.startLocked(key, q)
+	}
+	m.mu.Unlock()
+}
+
+// Cancel cancels the scan with ID scanID, or every scan of path if scanID is
+// empty, and returns how many were cancelled. A running scan stops at the next
+// file; a queued one never starts.
+func (m *Manager) Cancel(scanID, path string) int {
+	key := ""
+	if path != "" {
+		key = filepath.Clean(path)
+	}
+	match := func(k string, j *Job) bool {
+		if scanID != "" {
+			return j.ID == scanID
+		}
+		return k == key
+	}
+
+	m.mu.Lock()
+	n := 0
+	for k, j := range m.running {
+		if match(k, j) {
+			j.cancel()
+			n++
+		}
+	}
+	var dropped []*Job
+	for k, j := range m.queued {
+		if match(k, j) {
+			delete(m.queued, k)
+			dropped = append(dropped, j)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, j := range dropped {
+		m.drop(j)
+	}
+	return n + len(dropped)
+}
+
+// drop ends a queued job that will not run.
+func (m *Manager) drop(j *Job) {
+	j.cancel()
+	j.err = context.Canceled
+	m.scanner.publisher.SendEvent("scan.cancelled", models.ScanCancelledData{ScanID: j.ID, Path: j.Path})
+	close(j.done)
+}
+
+// Busy reports whether a scan of path is running or queued.
+func (m *Manager) Busy(path string) bool {
+	key := filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, running := m.running[key]
+	_, queued := m.queued[key]
+	return running || queued
+}
+
+// Status lists the running scans, then the queued ones, by path.
+func (m *Manager) Status() []models.ScanStatusItem {
+	m.mu.Lock()
+	var jobs []*Job
+	for _, j := range m.running {
+		jobs = append(jobs, j)
+	}
+	for _, j := range m.queued {
+		jobs = append(jobs, j)
+	}
+	items := make([]models.ScanStatusItem, 0, len(jobs))
+	for _, j := range jobs {
+		item := models.ScanStatusItem{ScanID: j.ID, Path: j.Path, Mode: j.mode, State: j.state}
+		if j.state == StateRunning {
+			started := j.started.UTC()
+			item.StartedAt = &started
+			item.FilesScanned, item.DirsScanned, _ = m.scanner.Progress(j.ID)
+		}
+		items = append(items, item)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(items, func(i, k int) bool {
+		if items[i].State != items[k].State {
+			return items[i].State == StateRunning
+		}
+		return items[i].Path < items[k].Path
+	})
+	return items
+}
+
+// Stop cancels every scan and refuses new ones, for shutdown.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	m.stopped = true
+	for _, j := range m.running {
+		j.cancel()
+	}
+	dropped := make([]*Job, 0, len(m.queued))
+	for k, j := range m.queued {
+		delete(m.queued, k)
+		dropped = append(dropped, j)
+	}
+	m.mu.Unlock()
+
+	for _, j := range dropped {
+		m.drop(j)
+	}
+}
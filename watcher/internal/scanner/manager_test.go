@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
+)
+
+// blockFirstScan holds the first scan of s at its start until the returned
+// function is called.
+func blockFirstScan(s *Scanner) (release func()) {
+	gate := make(chan struct{})
+	var once sync.Once
+	s.Available = func(string) bool {
+		once.Do(func() { <-gate })
+		return true
+	}
+	return func() { close(gate) }
+}
+
+// waitRunning waits until job is the running scan of its path.
+func waitRunning(t *testing.T, m *Manager, job *Job) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, item := range m.Status() {
+			if item.ScanID == job.ID && item.State == StateRunning {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("scan %s never ran", job.ID)
+}
+
+func TestManager_QueuesAndMergesPerPath(t *testing.T) {
+	rec := publisher.NewRecorder()
+	s := New(rec)
+	release := blockFirstScan(s)
+	m := NewManager(s)
+	dir := t.TempDir()
+	createTempMediaFiles(t, dir, 2)
+
+	first, merged := m.Submit(dir, "scan-1", ModeFull)
+	if merged {
+		t.Fatal("first request merged")
+	}
+	waitRunning(t, m, first)
+
+	second, merged := m.Submit(dir, "scan-2", ModeIncremental)
+	if merged || second.ID != "scan-2" {
+		t.Fatalf("second request = %s merged %v, want queued scan-2", second.ID, merged)
+	}
+	third, merged := m.Submit(dir+"/", "scan-3", ModeFull)
+	if !merged || third != second {
+		t.Fatalf("third request = %s merged %v, want merged into scan-2", third.ID, merged)
+	}
+	if !m.Busy(dir) {
+		t.Error("Busy = false with scans running and queued")
+	}
+
+	status := m.Status()
+	if len(status) != 2 || status[0].ScanID != "scan-1" || status[0].State != StateRunning || status[0].StartedAt == nil ||
+		status[1].ScanID != "scan-2" || status[1].State != StateQueued || status[1].Mode != ModeFull {
+		t.Fatalf("Status = %+v, want scan-1 running then scan-2 queued (raised to full)", status)
+	}
+
+	release()
+	if err := first.Wait(); err != nil {
+		t.Fatalf("scan-1: %v", err)
+	}
+	if err := second.Wait(); err != nil {
+		t.Fatalf("scan-2: %v", err)
+	}
+	var ids []string
+	for _, e := range rec.EventsOfType("scan.started") {
+		ids = append(ids, e.Data.(models.ScanStartedData).ScanID)
+	}
+	if len(ids) != 2 || ids[0] != "scan-1" || ids[1] != "scan-2" {
+		t.Errorf("scans started = %v, want [scan-1 scan-2]", ids)
+	}
+	if m.Busy(dir) || len(m.Status()) != 0 {
+		t.Errorf("scans still listed after completion: %+v", m.Status())
+	}
+}
+
+func TestManager_Cancel(t *testing.T) {
+	rec := publisher.NewRecorder()
+	s := New(rec)
+	release := blockFirstScan(s)
+	m := NewManager(s)
+	dir := t.TempDir()
+	createTempMediaFiles(t, dir, 2)
+
+	running, _ := m.Submit(dir, "scan-run", ModeFull)
+	waitRunning(t, m, running)
+	queued, _ := m.Submit(dir, "scan-queued", ModeFull)
+
+	if n := m.Cancel("scan-queued", ""); n != 1 {
+		t.Fatalf("Cancel(queued) = %d, want 1", n)
+	}
+	if err := queued.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("queued scan error = %v, want context.Canceled", err)
+	}
+	if n := m.Cancel("", dir); n != 1 {
+		t.Fatalf("Cancel(path) = %d, want 1", n)
+	}
+	release()
+	if err := running.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("running scan error = %v, want context.Canceled", err)
+	}
+
+	if n := len(rec.EventsOfType("scan.cancelled")); n != 2 {
+		t.Errorf("got %d scan.cancelled events, want 2", n)
+	}
+	if n := len(rec.EventsOfType("scan.completed")); n != 0 {
+		t.Errorf("got %d scan.completed events for cancelled scans, want none", n)
+	}
+	if n := m.Cancel("nope", ""); n != 0 {
+		t.Errorf("Cancel(unknown) = %d, want 0", n)
+	}
+
+	m.Stop()
+	job, _ := m.Submit(dir, "scan-late", ModeFull)
+	if err := job.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("scan submitted after Stop: error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/voclinx/scanarr-watcher/internal/hardlink"
+)
+
+// defaultHashWorkers is how many files a scan hashes at once, unless the API
+// configures scan_hash_workers.
+const defaultHashWorkers = 4
+
+// scanQueue bounds how far the walk runs ahead of the files reported, and so
+// the memory a scan holds.
+const scanQueue = 1024
+
+// scanFile is a media file found by the walk. A hashing worker examines it, then
+// it is reported in walk order once done is closed.
+type scanFile struct {
+	path  string
+	info  os.FileInfo
+	dev   uint64 // device the file is on, to apply the per-device limit
+	dirs  int    // directories walked when the file was found, for progress
+	prev  catalogEntry
+	known bool // prev holds what the previous scan recorded
+
+	// Set by the worker before done is closed
+	link      hardlink.FileInfo
+	entry     catalogEntry
+	eventType string // "" when an incremental scan has nothing to report
+	done      chan struct{}
+}
+
+// examine stats and hashes f, and decides what to report about it. Files
+// unchanged since the previous scan of an incremental one are not hashed again.
+func (s *Scanner) examine(f *scanFile, incremental bool) {
+	defer close(f.done)
+
+	link, err := hardlink.Info(f.path)
+	if err != nil {
+		link = hardlink.FileInfo{Nlink: 1}
+	}
+	f.link = link
+	f.entry = catalogEntry{
+		DeviceID: link.DeviceID,
+		Inode:    link.Inode,
+		Nlink:    link.Nlink,
+		Size:     f.info.Size(),
+		ModTime:  f.info.ModTime().UnixNano(),
+	}
+
+	f.eventType = "scan.file"
+	if incremental {
+		switch {
+		case f.known && f.prev.unchanged(f.entry) && f.prev.Hash != "":
+			f.entry.Hash = f.prev.Hash
+			f.eventType = ""
+			return
+		case f.known:
+			f.eventType = "scan.changed"
+		default:
+			f.eventType = "scan.added"
+		}
+	}
+
+	// Calculate partial hash (graceful failure)
+	partialHash, hashErr := s.HashCache.Calculate(f.path)
+	if hashErr != nil {
+		slog.Warn("Failed to calculate partial hash", "path", f.path, "error", hashErr)
+		partialHash = ""
+	}
+	f.entry.Hash = partialHash
+	if f.eventType == "scan.changed" && partialHash == "" && f.prev.unchanged(f.entry) {
+		// Still unreadable, nothing new to report
+		f.eventType = ""
+	}
+}
+
+// hashPool examines files with at most total of them at once, and at most
+// perDevice on any one device, so a slow disk does not hold every worker while
+// files of other disks wait. Each device gets its own queue and workers.
+type hashPool struct {
+	total     chan struct{} // one token per file being examined
+	perDevice int
+	work      func(*scanFile)
+
+	mu     sync.Mutex
+	queues map[uint64]chan *scanFile
+	wg     sync.WaitGroup
+}
+
+func newHashPool(total, perDevice int, work func(*scanFile)) *hashPool {
+	if perDevice <= 0 || perDevice > total {
+		perDevice = total
+	}
+	return &hashPool{
+		total:     make(chan struct{}, total),
+		perDevice: perDevice,
+		work:      work,
+		queues:    make(map[uint64]chan *scanFile),
+	}
+}
+
+// submit queues f on the queue of its device, starting that device's workers
+// on its first file.
+func (p *hashPool) submit(f *scanFile) {
+	p.mu.Lock()
+	q, ok := p.queues[f.dev]
+	if !ok {
+		q = make(chan *scanFile, scanQueue)
+		p.queues[f.dev] = q
+		for i := 0; i < p.perDevice; i++ {
+			p.wg.Add(1)
+			go p.run(q)
+		}
+	}
+	p.mu.Unlock()
+	q <- f
+}
+
+func (p *hashPool) run(q chan *scanFile) {
+	defer p.wg.Done()
+	for f := range q {
+		p.total <- struct{}{}
+		p.work(f)
+		<-p.total
+	}
+}
+
+// close waits for the queued files to be examined and stops the workers.
+func (p *hashPool) close() {
+	p.mu.Lock()
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
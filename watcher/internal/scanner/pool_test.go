@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHashPool_BoundsWorkers(t *testing.T) {
+	var mu sync.Mutex
+	running := make(map[uint64]int)
+	var total, maxTotal int
+	maxPerDev := make(map[uint64]int)
+
+	pool := newHashPool(3, 2, func(f *scanFile) {
+		mu.Lock()
+		running[f.dev]++
+		total++
+		maxPerDev[f.dev] = max(maxPerDev[f.dev], running[f.dev])
+		maxTotal = max(maxTotal, total)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running[f.dev]--
+		total--
+		mu.Unlock()
+		close(f.done)
+	})
+
+	var files []*scanFile
+	for i := 0; i < 24; i++ {
+		f := &scanFile{dev: uint64(i % 3), done: make(chan struct{})}
+		files = append(files, f)
+		pool.submit(f)
+	}
+	pool.close()
+
+	for _, f := range files {
+		select {
+		case <-f.done:
+		default:
+			t.Fatal("pool closed with a file not examined")
+		}
+	}
+	if maxTotal > 3 {
+		t.Errorf("%d files examined at once, want at most 3", maxTotal)
+	}
+	for dev, n := range maxPerDev {
+		if n > 2 {
+			t.Errorf("device %d: %d files examined at once, want at most 2", dev, n)
+		}
+	}
+}
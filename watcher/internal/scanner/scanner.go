@@ -1,102 +1,305 @@
 package scanner
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/voclinx/scanarr-watcher/internal/filter"
-	"github.com/voclinx/scanarr-watcher/internal/hardlink"
 	"github.com/voclinx/scanarr-watcher/internal/hash"
 	"github.com/voclinx/scanarr-watcher/internal/models"
-	"github.com/voclinx/scanarr-watcher/internal/websocket"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
 )
 
-// Scanner performs recursive directory scans and reports results via WebSocket.
+// ErrUnavailable is returned by Scan when the volume holding the path is not
+// mounted or not readable: a scan would report its files as gone.
+var ErrUnavailable = errors.New("volume unavailable")
+
+// Scan modes, as sent in scan.started and scan.completed.
+const (
+	ModeFull        = "full"
+	ModeIncremental = "incremental"
+)
+
+// Scanner performs recursive directory scans and reports results to the API.
 type Scanner struct {
-	wsClient *websocket.Client
+	publisher publisher.EventPublisher
+
+	// Available, if set, tells whether the volume holding a path is there.
+	// It is checked before a scan starts and before it is reported completed.
+	Available func(path string) bool
+
+	// HashCache, if set, serves the partial hash of files hashed before.
+	HashCache *hash.Cache
+
+	// workers bounds how many files a scan hashes at once, workersPerDevice how
+	// many on one device (0: no per-device bound). Guarded by mu.
+	workers, workersPerDevice int
+
+	// catalogDir keeps the file list of the last scan of each path; empty
+	// disables incremental scans.
+	catalogDir string
+
+	mu       sync.Mutex
+	progress map[string]*scanCounter // scan ID → files and dirs seen so far
+}
+
+// scanCounter is the progress of a running scan, as sent in scan.progress.
+type scanCounter struct {
+	files, dirs atomic.Int64
 }
 
 // New creates a new Scanner.
-func New(wsClient *websocket.Client) *Scanner {
-	return &Scanner{wsClient: wsClient}
+func New(pub publisher.EventPublisher) *Scanner {
+	return &Scanner{
+		publisher: pub,
+		progress:  make(map[string]*scanCounter),
+		workers:   defaultHashWorkers,
+	}
 }
 
-// Scan performs a recursive scan of the given path and sends results via WebSocket.
+// SetWorkers sets how many files a scan hashes concurrently, in total and on any
+// one device (perDevice <= 0: no per-device bound). total <= 0 restores the
+// default. Takes effect from the next scan.
+func (s *Scanner) SetWorkers(total, perDevice int) {
+	if total <= 0 {
+		total = defaultHashWorkers
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers, s.workersPerDevice = total, max(perDevice, 0)
+}
+
+// EnableCatalog records the file list of every completed scan under dir, so that
+// the next scan of the same path can be incremental.
+func (s *Scanner) EnableCatalog(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	s.catalogDir = dir
+	return nil
+}
+
+// Progress returns how many files and directories the running scan scanID has
+// seen so far. False if no such scan is running.
+func (s *Scanner) Progress(scanID string) (files, dirs int, ok bool) {
+	s.mu.Lock()
+	c, ok := s.progress[scanID]
+	s.mu.Unlock()
+	if !ok {
+		return 0, 0, false
+	}
+	return int(c.files.Load()), int(c.dirs.Load()), true
+}
+
+// Scan performs a recursive scan of the given path and sends results to the API.
 func (s *Scanner) Scan(path string, scanID string) error {
-	slog.Info("Starting scan", "path", path, "scan_id", scanID)
+	return s.scan(context.Background(), path, scanID, false)
+}
+
+// ScanIncremental scans path and reports only what changed since its last scan:
+// scan.added, scan.changed and scan.removed instead of scan.file for every file,
+// and a summary in scan.completed. Unchanged files are not hashed again. Falls
+// back to a full scan when there is no catalog of path yet.
+func (s *Scanner) ScanIncremental(path string, scanID string) error {
+	return s.scan(context.Background(), path, scanID, true)
+}
+
+// ScanContext runs a scan in the given mode (ModeFull or ModeIncremental) until
+// it completes or ctx is cancelled. A cancelled scan sends scan.cancelled instead
+// of scan.completed, keeps the previous catalog, and returns ctx's error.
+func (s *Scanner) ScanContext(ctx context.Context, path, scanID, mode string) error {
+	return s.scan(ctx, path, scanID, mode == ModeIncremental)
+}
+
+func (s *Scanner) scan(ctx context.Context, path string, scanID string, incremental bool) error {
+	if s.Available != nil && !s.Available(path) {
+		return fmt.Errorf("%w: %s", ErrUnavailable, path)
+	}
+
+	key := filepath.Clean(path)
+	var prev *catalog
+	if incremental && s.catalogDir != "" {
+		c, err := loadCatalog(s.catalogDir, key)
+		if err != nil {
+			slog.Warn("Failed to read scan catalog, running a full scan", "path", path, "error", err)
+		} else if c == nil {
+			slog.Info("No catalog of this path yet, running a full scan", "path", path)
+		}
+		prev = c
+	}
+	mode := ModeFull
+	if prev != nil {
+		mode = ModeIncremental
+	}
+	var next *catalog
+	if s.catalogDir != "" {
+		next = newCatalog(key)
+	}
 
-	s.wsClient.SendEvent("scan.started", models.ScanStartedData{
+	slog.Info("Starting scan", "path", path, "scan_id", scanID, "mode", mode)
+
+	counter := &scanCounter{}
+	s.mu.Lock()
+	s.progress[scanID] = counter
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.progress[scanID] == counter {
+			delete(s.progress, scanID)
+		}
+		s.mu.Unlock()
+	}()
+
+	s.publisher.SendEvent("scan.started", models.ScanStartedData{
 		Path:   path,
 		ScanID: scanID,
+		Mode:   mode,
+	})
+
+	s.mu.Lock()
+	workers, perDevice := s.workers, s.workersPerDevice
+	s.mu.Unlock()
+	pool := newHashPool(workers, perDevice, func(f *scanFile) {
+		if ctx.Err() != nil {
+			close(f.done) // cancelled: drained without being reported
+			return
+		}
+		s.examine(f, prev != nil)
 	})
 
 	startTime := time.Now()
 	totalFiles := 0
 	totalDirs := 0
 	var totalSize int64
+	var changes models.ScanChangesData
+	var unreadable []string // paths whose contents were not seen
 
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			slog.Warn("Error accessing path", "path", filePath, "error", err)
-			return nil // continue scanning
-		}
+	// The walk runs ahead while workers hash; files are reported in walk order
+	// from pending, so events and progress are the same as a sequential scan.
+	pending := make(chan *scanFile, scanQueue)
+	var err error
+	go func() {
+		defer close(pending)
+		err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				slog.Warn("Error accessing path", "path", filePath, "error", err)
+				unreadable = append(unreadable, filePath)
+				return nil // continue scanning
+			}
 
-		if info.IsDir() {
-			if filter.IsIgnoredDir(filePath) {
-				return filepath.SkipDir
+			if info.IsDir() {
+				if filter.IsIgnoredDir(filePath) {
+					return filepath.SkipDir
+				}
+				totalDirs++
+				return nil
 			}
-			totalDirs++
-			return nil
-		}
 
-		if !filter.ShouldProcess(filePath) {
-			return nil
-		}
+			if !filter.ShouldProcess(filePath) {
+				return nil
+			}
 
-		fileInfo, hlErr := hardlink.Info(filePath)
-		if hlErr != nil {
-			fileInfo = hardlink.FileInfo{Nlink: 1}
-		}
+			f := &scanFile{path: filePath, info: info, dirs: totalDirs, done: make(chan struct{})}
+			if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				f.dev = uint64(st.Dev)
+			}
+			if prev != nil {
+				f.prev, f.known = prev.Files[filePath]
+			}
+			pending <- f
+			pool.submit(f)
+			return nil
+		})
+	}()
 
-		// Calculate partial hash (graceful failure)
-		partialHash, hashErr := hash.Calculate(filePath)
-		if hashErr != nil {
-			slog.Warn("Failed to calculate partial hash", "path", filePath, "error", hashErr)
-			partialHash = ""
+	for f := range pending {
+		<-f.done
+		if ctx.Err() != nil {
+			continue
 		}
 
 		totalFiles++
-		totalSize += info.Size()
-
-		s.wsClient.SendEvent("scan.file", models.ScanFileData{
-			ScanID:        scanID,
-			Path:          filePath,
-			Name:          info.Name(),
-			SizeBytes:     info.Size(),
-			HardlinkCount: fileInfo.Nlink,
-			Inode:         fileInfo.Inode,
-			DeviceID:      fileInfo.DeviceID,
-			IsDir:         false,
-			ModTime:       info.ModTime().UTC(),
-			PartialHash:   partialHash,
-		})
+		counter.files.Store(int64(totalFiles))
+		counter.dirs.Store(int64(f.dirs))
+		totalSize += f.info.Size()
+
+		switch f.eventType {
+		case "":
+			changes.Unchanged++
+		case "scan.added":
+			changes.Added++
+		case "scan.changed":
+			changes.Changed++
+		}
+		if f.eventType != "" {
+			s.publisher.SendEvent(f.eventType, models.ScanFileData{
+				ScanID:        scanID,
+				Path:          f.path,
+				Name:          f.info.Name(),
+				SizeBytes:     f.info.Size(),
+				HardlinkCount: f.link.Nlink,
+				Inode:         f.link.Inode,
+				DeviceID:      f.link.DeviceID,
+				IsDir:         false,
+				ModTime:       f.info.ModTime().UTC(),
+				PartialHash:   f.entry.Hash,
+			})
+		}
+		if next != nil {
+			next.Files[f.path] = f.entry
+		}
 
 		// Send progress every 100 files
 		if totalFiles%100 == 0 {
-			s.wsClient.SendEvent("scan.progress", models.ScanProgressData{
+			s.publisher.SendEvent("scan.progress", models.ScanProgressData{
 				ScanID:       scanID,
 				FilesScanned: totalFiles,
-				DirsScanned:  totalDirs,
+				DirsScanned:  f.dirs,
 			})
 		}
+	}
+	pool.close()
 
-		return nil
-	})
+	if ctx.Err() != nil {
+		slog.Info("Scan cancelled", "path", path, "scan_id", scanID, "files_seen", totalFiles)
+		s.publisher.SendEvent("scan.cancelled", models.ScanCancelledData{
+			ScanID:       scanID,
+			Path:         path,
+			FilesScanned: totalFiles,
+		})
+		return ctx.Err()
+	}
+
+	// A volume lost mid-walk makes the file list look like a wiped library:
+	// never report it as complete.
+	if s.Available != nil && !s.Available(path) {
+		slog.Warn("Volume lost during scan, not reporting it completed", "path", path, "scan_id", scanID, "files_seen", totalFiles)
+		return fmt.Errorf("%w: %s", ErrUnavailable, path)
+	}
+
+	if prev != nil {
+		s.reportRemoved(scanID, prev, next, unreadable, &changes)
+	}
 
 	duration := time.Since(startTime)
+	var filesPerSecond, bytesPerSecond float64
+	if secs := duration.Seconds(); secs > 0 {
+		filesPerSecond = float64(totalFiles) / secs
+		bytesPerSecond = float64(totalSize) / secs
+	}
 
 	// Get filesystem disk space via statfs
 	var diskTotalBytes, diskFreeBytes int64
@@ -108,7 +311,7 @@ func (s *Scanner) Scan(path string, scanID string) error {
 		slog.Warn("Failed to get disk space", "path", path, "error", statErr)
 	}
 
-	s.wsClient.SendEvent("scan.completed", models.ScanCompletedData{
+	s.publisher.SendEvent("scan.completed", models.ScanCompletedData{
 		ScanID:         scanID,
 		Path:           path,
 		TotalFiles:     totalFiles,
@@ -117,17 +320,78 @@ func (s *Scanner) Scan(path string, scanID string) error {
 		DiskTotalBytes: diskTotalBytes,
 		DiskFreeBytes:  diskFreeBytes,
 		DurationMs:     duration.Milliseconds(),
+		FilesPerSecond: filesPerSecond,
+		BytesPerSecond: bytesPerSecond,
+		HashWorkers:    workers,
+		Mode:           mode,
+		Changes:        changesOf(prev, changes),
 	})
 
+	if next != nil && err == nil {
+		next.ScannedAt = startTime.UTC()
+		if saveErr := next.save(s.catalogDir); saveErr != nil {
+			slog.Warn("Failed to save scan catalog", "path", path, "error", saveErr)
+		}
+	}
+
 	slog.Info("Scan completed",
 		"path", path,
 		"scan_id", scanID,
 		"total_files", totalFiles,
 		"total_dirs", totalDirs,
+		"mode", mode,
 		"disk_total_bytes", diskTotalBytes,
 		"disk_free_bytes", diskFreeBytes,
 		"duration_ms", duration.Milliseconds(),
+		"files_per_second", int(filesPerSecond),
+		"hash_workers", workers,
 	)
 
 	return err
 }
+
+// reportRemoved sends scan.removed for the files of prev not seen by this scan.
+// Files under a path that could not be read are not known to be gone: they are
+// kept in the next catalog instead.
+func (s *Scanner) reportRemoved(scanID string, prev, next *catalog, unreadable []string, changes *models.ScanChangesData) {
+	var gone []string
+	for filePath := range prev.Files {
+		if _, ok := next.Files[filePath]; !ok {
+			gone = append(gone, filePath)
+		}
+	}
+	sort.Strings(gone)
+
+	for _, filePath := range gone {
+		entry := prev.Files[filePath]
+		if underAny(filePath, unreadable) {
+			next.Files[filePath] = entry
+			continue
+		}
+		changes.Removed++
+		s.publisher.SendEvent("scan.removed", models.ScanRemovedData{
+			ScanID:   scanID,
+			Path:     filePath,
+			Inode:    entry.Inode,
+			DeviceID: entry.DeviceID,
+		})
+	}
+}
+
+// changesOf returns the summary sent with an incremental scan, nil for a full one.
+func changesOf(prev *catalog, changes models.ScanChangesData) *models.ScanChangesData {
+	if prev == nil {
+		return nil
+	}
+	return &changes
+}
+
+// underAny reports whether path is one of dirs or lies below one of them.
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -14,12 +15,13 @@ import (
 
 	gorilla_ws "github.com/gorilla/websocket"
 	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
 	"github.com/voclinx/scanarr-watcher/internal/websocket"
 )
 
 // newTestWSServer creates a test WebSocket server that collects all messages
 // sent by the client into a channel. The server automatically reads and
-// discards the initial auth message.
+// discards the initial auth message, and approves the connection.
 func newTestWSServer(t *testing.T) (*httptest.Server, chan []byte) {
 	t.Helper()
 	messages := make(chan []byte, 5000)
@@ -42,6 +44,12 @@ func newTestWSServer(t *testing.T) (*httptest.Server, chan []byte) {
 			return
 		}
 
+		// Approve the connection: the client only writes events once approved
+		if err := conn.WriteJSON(models.Message{Type: "watcher.config", Timestamp: time.Now().UTC()}); err != nil {
+			t.Logf("failed to send config: %v", err)
+			return
+		}
+
 		// Read all subsequent messages
 		for {
 			_, msg, err := conn.ReadMessage()
@@ -479,3 +487,205 @@ func TestScan_EmptyDirectory(t *testing.T) {
 		t.Errorf("scan.file count = %d, want 0 (empty directory)", fileEvents)
 	}
 }
+
+// TestScan_WithRecorder verifies a scan can be exercised without a WebSocket connection.
+func TestScan_WithRecorder(t *testing.T) {
+	rec := publisher.NewRecorder()
+	scanner := New(rec)
+
+	tmpDir := t.TempDir()
+	createTempMediaFiles(t, tmpDir, 3)
+
+	if err := scanner.Scan(tmpDir, "test-scan-rec"); err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+
+	events := rec.Events()
+	if len(events) != 5 {
+		t.Fatalf("event count = %d, want 5 (started + 3 files + completed)", len(events))
+	}
+	if events[0].Type != "scan.started" || events[4].Type != "scan.completed" {
+		t.Errorf("first/last events = %q/%q, want scan.started/scan.completed", events[0].Type, events[4].Type)
+	}
+	for _, e := range events[1:4] {
+		data, ok := e.Data.(models.ScanFileData)
+		if !ok || data.ScanID != "test-scan-rec" || data.PartialHash == "" {
+			t.Errorf("scan.file data = %#v, want ScanFileData with scan_id and partial hash", e.Data)
+		}
+	}
+}
+
+func TestScan_UnavailableVolume(t *testing.T) {
+	rec := publisher.NewRecorder()
+	scanner := New(rec)
+	tmpDir := t.TempDir()
+	createTempMediaFiles(t, tmpDir, 3)
+
+	// Unavailable from the start: nothing is sent
+	scanner.Available = func(string) bool { return false }
+	if err := scanner.Scan(tmpDir, "scan-down"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Scan error = %v, want ErrUnavailable", err)
+	}
+	if n := len(rec.Events()); n != 0 {
+		t.Fatalf("got %d events for an unavailable volume, want none", n)
+	}
+
+	// Lost during the walk: never reported completed
+	checks := 0
+	scanner.Available = func(string) bool { checks++; return checks == 1 }
+	if err := scanner.Scan(tmpDir, "scan-lost"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Scan error = %v, want ErrUnavailable", err)
+	}
+	if n := len(rec.EventsOfType("scan.completed")); n != 0 {
+		t.Errorf("got %d scan.completed events, want none", n)
+	}
+}
+
+func TestScanIncremental_ReportsChanges(t *testing.T) {
+	rec := publisher.NewRecorder()
+	scanner := New(rec)
+	if err := scanner.EnableCatalog(t.TempDir()); err != nil {
+		t.Fatalf("EnableCatalog: %v", err)
+	}
+	tmpDir := t.TempDir()
+	createTempMediaFiles(t, tmpDir, 3)
+
+	// No catalog yet: a full scan, which records one
+	if err := scanner.ScanIncremental(tmpDir, "scan-1"); err != nil {
+		t.Fatalf("ScanIncremental: %v", err)
+	}
+	if n := len(rec.EventsOfType("scan.file")); n != 3 {
+		t.Fatalf("first scan sent %d scan.file events, want 3", n)
+	}
+	if data := rec.EventsOfType("scan.started")[0].Data.(models.ScanStartedData); data.Mode != ModeFull {
+		t.Errorf("first scan mode = %q, want %q", data.Mode, ModeFull)
+	}
+	rec.Reset()
+
+	changed := filepath.Join(tmpDir, "movie_0000.mkv")
+	if err := os.WriteFile(changed, make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+	removed := filepath.Join(tmpDir, "movie_0001.mkv")
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	added := filepath.Join(tmpDir, "new.mkv")
+	if err := os.WriteFile(added, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scanner.ScanIncremental(tmpDir, "scan-2"); err != nil {
+		t.Fatalf("ScanIncremental: %v", err)
+	}
+	if n := len(rec.EventsOfType("scan.file")); n != 0 {
+		t.Errorf("incremental scan sent %d scan.file events, want none", n)
+	}
+	for typ, want := range map[string]string{"scan.added": added, "scan.changed": changed} {
+		events := rec.EventsOfType(typ)
+		if len(events) != 1 || events[0].Data.(models.ScanFileData).Path != want {
+			t.Errorf("%s events = %v, want one for %s", typ, events, want)
+		}
+	}
+	events := rec.EventsOfType("scan.removed")
+	if len(events) != 1 || events[0].Data.(models.ScanRemovedData).Path != removed {
+		t.Errorf("scan.removed events = %v, want one for %s", events, removed)
+	}
+
+	completed := rec.EventsOfType("scan.completed")
+	if len(completed) != 1 {
+		t.Fatalf("got %d scan.completed events, want 1", len(completed))
+	}
+	data := completed[0].Data.(models.ScanCompletedData)
+	want := models.ScanChangesData{Added: 1, Changed: 1, Removed: 1, Unchanged: 1}
+	if data.Mode != ModeIncremental || data.Changes == nil || *data.Changes != want {
+		t.Errorf("scan.completed mode = %q, changes = %+v, want %q, %+v", data.Mode, data.Changes, ModeIncremental, want)
+	}
+	if data.TotalFiles != 3 {
+		t.Errorf("total_files = %d, want 3", data.TotalFiles)
+	}
+
+	// Nothing changed since: nothing but the summary
+	rec.Reset()
+	if err := scanner.ScanIncremental(tmpDir, "scan-3"); err != nil {
+		t.Fatalf("ScanIncremental: %v", err)
+	}
+	if n := len(rec.Events()); n != 2 {
+		t.Errorf("got %d events for an unchanged tree, want 2 (started + completed)", n)
+	}
+}
+
+func TestScanIncremental_WithoutCatalogIsFull(t *testing.T) {
+	rec := publisher.NewRecorder()
+	scanner := New(rec)
+	tmpDir := t.TempDir()
+	createTempMediaFiles(t, tmpDir, 2)
+
+	for _, id := range []string{"scan-1", "scan-2"} {
+		if err := scanner.ScanIncremental(tmpDir, id); err != nil {
+			t.Fatalf("ScanIncremental: %v", err)
+		}
+	}
+	if n := len(rec.EventsOfType("scan.file")); n != 4 {
+		t.Errorf("got %d scan.file events, want 4: every scan is full without a catalog", n)
+	}
+	for _, e := range rec.EventsOfType("scan.completed") {
+		if data := e.Data.(models.ScanCompletedData); data.Changes != nil {
+			t.Errorf("full scan reported changes %+v", data.Changes)
+		}
+	}
+}
+
+func TestScan_ParallelKeepsWalkOrder(t *testing.T) {
+	rec := publisher.NewRecorder()
+	scanner := New(rec)
+	scanner.SetWorkers(8, 0)
+
+	tmpDir := t.TempDir()
+	for _, sub := range []string{"a", "b"} {
+		dir := filepath.Join(tmpDir, sub)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		createTempMediaFiles(t, dir, 120)
+	}
+
+	if err := scanner.Scan(tmpDir, "scan-parallel"); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	// filepath.Walk visits in lexical order: every file of a/ before b/
+	var paths []string
+	for _, e := range rec.EventsOfType("scan.file") {
+		paths = append(paths, e.Data.(models.ScanFileData).Path)
+	}
+	if len(paths) != 240 {
+		t.Fatalf("got %d scan.file events, want 240", len(paths))
+	}
+	for i := 1; i < len(paths); i++ {
+		if paths[i-1] >= paths[i] {
+			t.Fatalf("scan.file out of walk order: %s before %s", paths[i-1], paths[i])
+		}
+	}
+
+	progress := rec.EventsOfType("scan.progress")
+	if len(progress) != 2 {
+		t.Fatalf("got %d scan.progress events, want 2", len(progress))
+	}
+	for i, e := range progress {
+		data := e.Data.(models.ScanProgressData)
+		if data.FilesScanned != (i+1)*100 {
+			t.Errorf("progress %d: files_scanned = %d, want %d", i, data.FilesScanned, (i+1)*100)
+		}
+	}
+	// The 200th file is in b/: both subdirectories (and the root) were walked by then
+	if dirs := progress[1].Data.(models.ScanProgressData).DirsScanned; dirs != 3 {
+		t.Errorf("second progress dirs_scanned = %d, want 3", dirs)
+	}
+
+	completed := rec.EventsOfType("scan.completed")[0].Data.(models.ScanCompletedData)
+	if completed.HashWorkers != 8 || completed.FilesPerSecond <= 0 || completed.BytesPerSecond <= 0 {
+		t.Errorf("scan.completed throughput = %v files/s, %v bytes/s, %d workers; want > 0 with 8 workers",
+			completed.FilesPerSecond, completed.BytesPerSecond, completed.HashWorkers)
+	}
+}
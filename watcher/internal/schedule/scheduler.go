@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Scheduler runs a job for each path on that path's schedule. A run is skipped
+// while the previous job (or any other work busy reports) on the path is going.
+type Scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	stopped bool
+
+	run  func(path string)
+	busy func(path string) bool
+	now  func() time.Time
+}
+
+// entry is the schedule of one path and the timer of its next run.
+type entry struct {
+	spec  string
+	sched *Schedule
+	timer *time.Timer
+}
+
+// New creates a Scheduler that calls run(path) when path is due, in its own
+// goroutine, unless busy(path) reports work in progress on it.
+func New(run func(path string), busy func(path string) bool) *Scheduler {
+	return &Scheduler{
+		entries: make(map[string]*entry),
+		run:     run,
+		busy:    busy,
+		now:     time.Now,
+	}
+}
+
+// Set replaces the schedules with specs (path → cron expression). Paths whose
+// expression did not change keep their next run. Invalid expressions are logged
+// and ignored.
+func (s *Scheduler) Set(specs map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+
+	for path, e := range s.entries {
+		if spec, ok := specs[path]; !ok || spec != e.spec {
+			if e.timer != nil {
+				e.timer.Stop()
+			}
+			delete(s.entries, path)
+		}
+	}
+	for path, spec := range specs {
+		if _, ok := s.entries[path]; ok || spec == "" {
+			continue
+		}
+		sched, err := Parse(spec)
+		if err != nil {
+			slog.Warn("Invalid scan schedule, ignored", "path", path, "error", err)
+			continue
+		}
+		e := &entry{spec: spec, sched: sched}
+		s.entries[path] = e
+		s.arm(path, e)
+	}
+}
+
+// arm starts the timer of e's next run. Called with s.mu held.
+func (s *Scheduler) arm(path string, e *entry) {
+	next := e.sched.Next(s.now())
+	if next.IsZero() {
+		slog.Warn("Scan schedule never due, ignored", "path", path, "schedule", e.spec)
+		return
+	}
+	slog.Debug("Next scheduled scan", "path", path, "at", next)
+	e.timer = time.AfterFunc(next.Sub(s.now()), func() { s.fire(path, e) })
+}
+
+func (s *Scheduler) fire(path string, e *entry) {
+	s.mu.Lock()
+	if s.entries[path] != e {
+		// Rescheduled or removed meanwhile
+		s.mu.Unlock()
+		return
+	}
+	s.arm(path, e)
+	s.mu.Unlock()
+
+	if s.busy != nil && s.busy(path) {
+		slog.Info("Scheduled scan skipped, a scan of this path is in progress", "path", path)
+		return
+	}
+	go s.run(path)
+}
+
+// Stop cancels every scheduled run.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for path, e := range s.entries {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		delete(s.entries, path)
+	}
+}
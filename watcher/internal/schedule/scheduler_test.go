@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScheduler returns a Scheduler whose clock stands still 50ms before a
+// minute boundary, so "* * * * *" is due every 50ms.
+func newTestScheduler(run func(string), busy func(string) bool) *Scheduler {
+	s := New(run, busy)
+	now := time.Now().Truncate(time.Minute).Add(time.Minute - 50*time.Millisecond)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestScheduler_RunsAndSkipsWhileBusy(t *testing.T) {
+	var runs, checks atomic.Int32
+	var busy atomic.Bool
+	busy.Store(true)
+	s := newTestScheduler(
+		func(path string) { runs.Add(1) },
+		func(path string) bool { checks.Add(1); return busy.Load() },
+	)
+	defer s.Stop()
+	s.Set(map[string]string{"/media/movies": "* * * * *"})
+
+	time.Sleep(300 * time.Millisecond)
+	if checks.Load() == 0 {
+		t.Fatal("schedule never came due")
+	}
+	if n := runs.Load(); n != 0 {
+		t.Errorf("got %d runs while a scan was in progress, want none", n)
+	}
+
+	busy.Store(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runs.Load() == 0 {
+		t.Error("no run once the path was idle")
+	}
+}
+
+func TestScheduler_SetRemovesSchedules(t *testing.T) {
+	var runs atomic.Int32
+	s := newTestScheduler(func(string) { runs.Add(1) }, nil)
+	defer s.Stop()
+
+	s.Set(map[string]string{"/media/movies": "* * * * *", "/media/shows": "not a schedule"})
+	if len(s.entries) != 1 {
+		t.Errorf("got %d schedules, want 1 (the invalid one ignored)", len(s.entries))
+	}
+	s.Set(nil)
+	time.Sleep(200 * time.Millisecond)
+	if n := runs.Load(); n != 0 {
+		t.Errorf("got %d runs after the schedule was removed, want none", n)
+	}
+}
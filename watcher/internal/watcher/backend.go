@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"errors"
+	"log/slog"
+	"sync/atomic"
+)
+
+// op is the kind of a filesystem event reported by a backend.
+type op uint32
+
+const (
+	opCreate op = 1 << iota
+	opWrite
+	// opCloseWrite means a writer closed the file; not every backend reports it.
+	opCloseWrite
+	opRemove
+	// opMovedFrom and opMovedTo are the two halves of a rename. Backends that
+	// know the kernel move cookie set event.cookie so the halves pair exactly.
+	opMovedFrom
+	opMovedTo
+	// opOverflow means the backend lost events; path is empty and source is set.
+	opOverflow
+	// opUnwatched means the kernel dropped the watch on directory path
+	// (deleted, or its filesystem unmounted).
+	opUnwatched
+)
+
+// event is a backend-neutral filesystem event.
+type event struct {
+	path   string
+	op     op
+	isDir  bool
+	cookie uint32 // pairs opMovedFrom/opMovedTo; 0 when the backend cannot tell
+
+	// source is the backend that lost events, for opOverflow: only the directories
+	// it watches missed changes.
+	source backend
+}
+
+// syntheticCookies feeds the move cookies of backends that see both ends of a
+// rename at once (fanotify FAN_RENAME, polling). They have the top bit set, far
+// above the cookies the kernel hands out for inotify.
+var syntheticCookies atomic.Uint32
+
+func nextCookie() uint32 {
+	return syntheticCookies.Add(1) | 1<<31
+}
+
+// backend delivers filesystem events for a set of watched directories.
+// Watches are not recursive: FileWatcher adds every directory of a tree.
+type backend interface {
+	// Name identifies the backend in logs.
+	Name() string
+	// Add watches a directory. Adding a directory twice is a no-op.
+	Add(dir string) error
+	// Remove stops watching a directory.
+	Remove(dir string) error
+	// Rename re-keys the watches under oldDir after the directory moved to newDir,
+	// without dropping them. Returns errors.ErrUnsupported if the backend cannot.
+	Rename(oldDir, newDir string) error
+	// WatchList returns the watched directories.
+	WatchList() []string
+	Events() <-chan event
+	Errors() <-chan error
+	Close() error
+}
+
+// newBackend returns the backends available to this process: fanotify whole-filesystem
+// marks when the process has CAP_SYS_ADMIN, with per-directory watches (native
+// inotify, or fsnotify if it is unavailable) for the filesystems fanotify declines.
+func newBackend() (backend, error) {
+	perDir, err := newPerDirBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	fa, err := newFanotifyBackend()
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			slog.Debug("fanotify unavailable, using per-directory watches", "error", err)
+		} else {
+			slog.Warn("fanotify unavailable, using per-directory watches", "error", err)
+		}
+		return perDir, nil
+	}
+	return newRoutedBackend(fa, perDir), nil
+}
+
+// newPerDirBackend returns the native inotify backend, or fsnotify if it is unavailable.
+func newPerDirBackend() (backend, error) {
+	b, err := newInotifyBackend()
+	if err == nil {
+		return b, nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		slog.Warn("Native inotify backend unavailable, falling back to fsnotify", "error", err)
+	}
+	return newFsnotifyBackend()
+}
@@ -0,0 +1,367 @@
+//go:build linux
+
+package watcher
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Not defined by the vendored x/sys (FAN_RENAME and its records are Linux 5.17+).
+const (
+	fanEventMetadataLen         = 24 // sizeof(struct fanotify_event_metadata)
+	fanRename                   = 0x10000000
+	fanEventInfoTypeOldDFIDName = 10
+	fanEventInfoTypeNewDFIDName = 12
+)
+
+// fanotifyMask is the set of events requested for every marked filesystem.
+// Renames are reported as FAN_RENAME when the kernel supports it, which carries
+// both ends of the move in one event; older kernels get FAN_MOVED_FROM/FAN_MOVED_TO.
+const fanotifyMask = unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MODIFY | unix.FAN_CLOSE_WRITE | unix.FAN_ONDIR
+
+// fanotifyBackend watches whole filesystems with one fanotify mark each, so the
+// number of watched directories is not bounded by fs.inotify.max_user_watches.
+// Events name their parent directory by file handle (FAN_REPORT_DFID_NAME); only
+// events whose parent is a directory added through Add are reported.
+// Requires CAP_SYS_ADMIN.
+type fanotifyBackend struct {
+	fd   int
+	file *os.File
+
+	mu      sync.Mutex
+	dirs    map[string]string // file handle key → directory
+	handles map[string]string // directory → file handle key
+	marks   map[string]int    // fsid key → number of directories on that filesystem
+	rename  bool              // FAN_RENAME accepted by the kernel
+
+	events chan event
+	errors chan error
+}
+
+func newFanotifyBackend() (*fanotifyBackend, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_LARGEFILE)
+	if err != nil {
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+			// No CAP_SYS_ADMIN, or a kernel older than 5.9
+			return nil, fmt.Errorf("%w: fanotify_init: %v", errors.ErrUnsupported, err)
+		}
+		return nil, fmt.Errorf("fanotify_init: %w", err)
+	}
+	b := &fanotifyBackend{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "fanotify"),
+		dirs:    make(map[string]string),
+		handles: make(map[string]string),
+		marks:   make(map[string]int),
+		rename:  true,
+		events:  make(chan event, 256),
+		errors:  make(chan error, 16),
+	}
+	go b.readLoop()
+	return b, nil
+}
+
+func (b *fanotifyBackend) Name() string { return "fanotify" }
+
+func (b *fanotifyBackend) Add(dir string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return err
+	}
+	fsid := fsidKey(st.Fsid.Val)
+	handle, _, err := unix.NameToHandleAt(unix.AT_FDCWD, dir, 0)
+	if err != nil {
+		// No file handles on this filesystem (some FUSE and network filesystems)
+		return fmt.Errorf("%w: name_to_handle_at %s: %v", errors.ErrUnsupported, dir, err)
+	}
+	key := fsid + handleKey(handle.Type(), handle.Bytes())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.dirs[key]; !ok {
+		if b.marks[fsid] == 0 {
+			if err := b.mark(dir); err != nil {
+				return fmt.Errorf("%w: fanotify mark on %s: %v", errors.ErrUnsupported, dir, err)
+			}
+		}
+		b.marks[fsid]++
+	}
+	// Same handle under a new path: the directory moved.
+	if old, ok := b.dirs[key]; ok && old != dir {
+		delete(b.handles, old)
+	}
+	b.dirs[key] = dir
+	b.handles[dir] = key
+	return nil
+}
+
+// mark adds the filesystem mark for the filesystem holding dir.
+func (b *fanotifyBackend) mark(dir string) error {
+	flags := uint(unix.FAN_MARK_ADD | unix.FAN_MARK_FILESYSTEM)
+	if b.rename {
+		err := unix.FanotifyMark(b.fd, flags, fanotifyMask|fanRename, unix.AT_FDCWD, dir)
+		if !errors.Is(err, unix.EINVAL) {
+			return err
+		}
+		b.rename = false
+	}
+	return unix.FanotifyMark(b.fd, flags, fanotifyMask|unix.FAN_MOVED_FROM|unix.FAN_MOVED_TO, unix.AT_FDCWD, dir)
+}
+
+func (b *fanotifyBackend) Remove(dir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key, ok := b.handles[dir]
+	if !ok {
+		return nil
+	}
+	fsid := key[:8]
+	if b.marks[fsid] == 1 {
+		if err := b.unmark(dir, fsid); err != nil {
+			return err
+		}
+	}
+
+	delete(b.handles, dir)
+	delete(b.dirs, key)
+	if b.marks[fsid]--; b.marks[fsid] <= 0 {
+		delete(b.marks, fsid)
+	}
+	return nil
+}
+
+// unmark removes the filesystem mark of fsid. dir, the last watched directory on
+// it, is usually deleted by now: the mark is removed through its closest existing
+// ancestor on the same filesystem instead.
+func (b *fanotifyBackend) unmark(dir, fsid string) error {
+	mask := uint64(fanotifyMask | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO)
+	if b.rename {
+		mask = fanotifyMask | fanRename
+	}
+	for p := dir; ; p = filepath.Dir(p) {
+		var st unix.Statfs_t
+		if err := unix.Statfs(p, &st); err != nil {
+			if p == filepath.Dir(p) {
+				return nil
+			}
+			continue
+		}
+		if fsidKey(st.Fsid.Val) != fsid {
+			// Crossed a mount point: the filesystem is unmounted, and its mark went with it.
+			return nil
+		}
+		err := unix.FanotifyMark(b.fd, unix.FAN_MARK_REMOVE|unix.FAN_MARK_FILESYSTEM, mask, unix.AT_FDCWD, p)
+		if !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+		if _, statErr := os.Stat(p); statErr == nil {
+			// p exists: ENOENT means the filesystem is not marked.
+			return nil
+		}
+		// p was removed in between: try its parent.
+	}
+}
+
+func (b *fanotifyBackend) Rename(oldDir, newDir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, dir := range b.dirs {
+		if !within(dir, oldDir) {
+			continue
+		}
+		moved := newDir + dir[len(oldDir):]
+		delete(b.handles, dir)
+		b.dirs[key] = moved
+		b.handles[moved] = key
+	}
+	return nil
+}
+
+func (b *fanotifyBackend) WatchList() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]string, 0, len(b.handles))
+	for dir := range b.handles {
+		out = append(out, dir)
+	}
+	return out
+}
+
+func (b *fanotifyBackend) Events() <-chan event { return b.events }
+
+func (b *fanotifyBackend) Errors() <-chan error { return b.errors }
+
+func (b *fanotifyBackend) Close() error {
+	return b.file.Close()
+}
+
+func (b *fanotifyBackend) readLoop() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				b.errors <- fmt.Errorf("read fanotify events: %w", err)
+			}
+			return
+		}
+
+		for off := 0; off+fanEventMetadataLen <= n; {
+			eventLen := int(binary.NativeEndian.Uint32(buf[off:]))
+			metaLen := int(binary.NativeEndian.Uint16(buf[off+6:]))
+			mask := binary.NativeEndian.Uint64(buf[off+8:])
+			fd := int32(binary.NativeEndian.Uint32(buf[off+16:]))
+			if eventLen < metaLen || off+eventLen > n {
+				break
+			}
+			if fd >= 0 {
+				_ = unix.Close(int(fd))
+			}
+			b.dispatch(mask, buf[off+metaLen:off+eventLen])
+			off += eventLen
+		}
+	}
+}
+
+// fanotifyRecord is a directory file handle plus entry name info record.
+type fanotifyRecord struct {
+	infoType uint8
+	dirKey   string
+	name     string
+}
+
+func (b *fanotifyBackend) dispatch(mask uint64, info []byte) {
+	if mask&unix.FAN_Q_OVERFLOW != 0 {
+		b.events <- event{op: opOverflow, source: b}
+		return
+	}
+
+	var oldEntry, newEntry, entry string
+	for _, rec := range parseFanotifyInfo(info) {
+		path, ok := b.resolve(rec)
+		if !ok {
+			continue
+		}
+		switch rec.infoType {
+		case fanEventInfoTypeOldDFIDName:
+			oldEntry = path
+		case fanEventInfoTypeNewDFIDName:
+			newEntry = path
+		case unix.FAN_EVENT_INFO_TYPE_DFID_NAME:
+			entry = path
+		}
+	}
+	isDir := mask&unix.FAN_ONDIR != 0
+
+	if mask&fanRename != 0 {
+		cookie := nextCookie()
+		// Either end may be outside the watched directories
+		if oldEntry != "" {
+			b.events <- event{path: oldEntry, op: opMovedFrom, isDir: isDir, cookie: cookie}
+		}
+		if newEntry != "" {
+			b.events <- event{path: newEntry, op: opMovedTo, isDir: isDir, cookie: cookie}
+		}
+	}
+	if entry == "" {
+		return
+	}
+
+	// Events on the same entry may be merged into one; report them in a sensible order.
+	for _, m := range []struct {
+		bit uint64
+		op  op
+	}{
+		{unix.FAN_CREATE, opCreate},
+		{unix.FAN_MOVED_TO, opMovedTo},
+		{unix.FAN_MODIFY, opWrite},
+		{unix.FAN_CLOSE_WRITE, opCloseWrite},
+		{unix.FAN_MOVED_FROM, opMovedFrom},
+		{unix.FAN_DELETE, opRemove},
+	} {
+		if mask&m.bit != 0 {
+			// Without FAN_RENAME there is no cookie: halves pair by proximity.
+			b.events <- event{path: entry, op: m.op, isDir: isDir}
+		}
+	}
+}
+
+// resolve maps an info record to the full path of its entry. Returns false if the
+// parent directory is not watched.
+func (b *fanotifyBackend) resolve(rec fanotifyRecord) (string, bool) {
+	b.mu.Lock()
+	dir, ok := b.dirs[rec.dirKey]
+	b.mu.Unlock()
+	if !ok || rec.name == "" || rec.name == "." {
+		return "", false
+	}
+	return dir + string(os.PathSeparator) + rec.name, true
+}
+
+// parseFanotifyInfo decodes the info records following an event's metadata.
+// Each record is a header (type, pad, len), the fsid, a struct file_handle and,
+// for the *_DFID_NAME types, a NUL-terminated name.
+func parseFanotifyInfo(info []byte) []fanotifyRecord {
+	var records []fanotifyRecord
+	for len(info) >= 4 {
+		infoType := info[0]
+		recLen := int(binary.NativeEndian.Uint16(info[2:]))
+		if recLen < 4 || recLen > len(info) {
+			break
+		}
+		rec := info[:recLen]
+		info = info[recLen:]
+
+		if recLen < 20 {
+			continue
+		}
+		fsid := string(rec[4:12])
+		handleBytes := int(binary.NativeEndian.Uint32(rec[12:]))
+		handleType := int32(binary.NativeEndian.Uint32(rec[16:]))
+		if 20+handleBytes > recLen {
+			continue
+		}
+		name := ""
+		if rest := rec[20+handleBytes:]; len(rest) > 0 {
+			name = strings.TrimRight(string(rest), "\x00")
+			if i := strings.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+		}
+		records = append(records, fanotifyRecord{
+			infoType: infoType,
+			dirKey:   fsid + handleKey(handleType, rec[20:20+handleBytes]),
+			name:     name,
+		})
+	}
+	return records
+}
+
+// fsidKey encodes a filesystem ID as the kernel lays it out in info records.
+func fsidKey(val [2]int32) string {
+	var buf [8]byte
+	binary.NativeEndian.PutUint32(buf[0:], uint32(val[0]))
+	binary.NativeEndian.PutUint32(buf[4:], uint32(val[1]))
+	return string(buf[:])
+}
+
+// handleKey encodes a file handle for use as a map key.
+func handleKey(handleType int32, handle []byte) string {
+	var buf [4]byte
+	binary.NativeEndian.PutUint32(buf[:], uint32(handleType))
+	return string(buf[:]) + string(handle)
+}
@@ -0,0 +1,124 @@
+//go:build linux
+
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// newTestFanotify returns a fanotify backend able to mark root, or skips the test.
+func newTestFanotify(t *testing.T, root string) *fanotifyBackend {
+	t.Helper()
+	b, err := newFanotifyBackend()
+	if err != nil {
+		t.Skipf("fanotify unavailable: %v", err)
+	}
+	if err := b.Add(root); err != nil {
+		_ = b.Close()
+		t.Skipf("fanotify cannot mark %s: %v", root, err)
+	}
+	_ = b.Remove(root)
+	return b
+}
+
+func TestFanotify_CreateAndRename(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "incoming"), filepath.Join(root, "movies")
+	for _, d := range []string{src, dst} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, rec := startWatcher(t, newTestFanotify(t, root), root)
+
+	oldPath, newPath := filepath.Join(src, "film.mkv"), filepath.Join(dst, "Film (2024).mkv")
+	writeFile(t, oldPath)
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != oldPath {
+		t.Errorf("created path = %s, want %s", p, oldPath)
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	events := waitForEvents(t, rec, "file.renamed", 1)
+	data := events[0].Data.(models.FileRenamedData)
+	if data.OldPath != oldPath || data.NewPath != newPath {
+		t.Errorf("renamed %s → %s, want %s → %s", data.OldPath, data.NewPath, oldPath, newPath)
+	}
+	if n := len(rec.EventsOfType("file.deleted")); n != 0 {
+		t.Errorf("got %d deleted events, want none for a rename", n)
+	}
+}
+
+func TestFanotify_DirectoryRename(t *testing.T) {
+	root := t.TempDir()
+	oldDir, newDir := filepath.Join(root, "Film"), filepath.Join(root, "Film (2024)")
+	if err := os.Mkdir(oldDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(oldDir, "film.mkv"))
+	_, rec := startWatcher(t, newTestFanotify(t, root), root)
+
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+	events := waitForEvents(t, rec, "file.renamed", 1)
+	if p := events[0].Data.(models.FileRenamedData).NewPath; p != filepath.Join(newDir, "film.mkv") {
+		t.Errorf("renamed to %s, want %s", p, filepath.Join(newDir, "film.mkv"))
+	}
+
+	// The moved directory is still watched under its new name.
+	writeFile(t, filepath.Join(newDir, "extra.mkv"))
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != filepath.Join(newDir, "extra.mkv") {
+		t.Errorf("created path = %s, want %s", p, filepath.Join(newDir, "extra.mkv"))
+	}
+}
+
+// TestFanotify_RemoveDeletedDir verifies the filesystem mark is removed when the
+// last watched directory on it no longer exists.
+func TestFanotify_RemoveDeletedDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "movies")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	b := newTestFanotify(t, root)
+	defer b.Close()
+
+	if err := b.Add(dir); err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+	if !fanotifyMarked(t, b) {
+		t.Fatal("no filesystem mark after Add()")
+	}
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove(dir); err != nil {
+		t.Fatalf("Remove() returned error: %v", err)
+	}
+	if fanotifyMarked(t, b) {
+		t.Error("filesystem mark left after removing the deleted directory")
+	}
+	if len(b.marks) != 0 {
+		t.Errorf("marks = %d filesystems, want none", len(b.marks))
+	}
+}
+
+// fanotifyMarked reports whether the kernel lists a filesystem mark on b's fd.
+func fanotifyMarked(t *testing.T, b *fanotifyBackend) bool {
+	t.Helper()
+	info, err := os.ReadFile(fmt.Sprintf("/proc/self/fdinfo/%d", b.fd))
+	if err != nil {
+		t.Skipf("fdinfo unavailable: %v", err)
+	}
+	return strings.Contains(string(info), "sdev:")
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watcher
+
+import "errors"
+
+func newFanotifyBackend() (backend, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsnotifyBackend adapts fsnotify. It exposes no move cookies, so renames are
+// paired by proximity (see FileWatcher.handleEvent).
+type fsnotifyBackend struct {
+	w      *fsnotify.Watcher
+	events chan event
+	errors chan error
+}
+
+func newFsnotifyBackend() (*fsnotifyBackend, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	b := &fsnotifyBackend{
+		w:      w,
+		events: make(chan event, 256),
+		errors: make(chan error, 16),
+	}
+	go b.translate()
+	return b, nil
+}
+
+func (b *fsnotifyBackend) Name() string { return "fsnotify" }
+
+func (b *fsnotifyBackend) Add(dir string) error { return b.w.Add(dir) }
+
+func (b *fsnotifyBackend) Remove(dir string) error { return b.w.Remove(dir) }
+
+func (b *fsnotifyBackend) Rename(oldDir, newDir string) error { return errors.ErrUnsupported }
+
+func (b *fsnotifyBackend) WatchList() []string { return b.w.WatchList() }
+
+func (b *fsnotifyBackend) Events() <-chan event { return b.events }
+
+func (b *fsnotifyBackend) Errors() <-chan error { return b.errors }
+
+func (b *fsnotifyBackend) Close() error { return b.w.Close() }
+
+func (b *fsnotifyBackend) translate() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	for {
+		select {
+		case ev, ok := <-b.w.Events:
+			if !ok {
+				return
+			}
+			var o op
+			switch {
+			case ev.Has(fsnotify.Create):
+				o = opCreate
+			case ev.Has(fsnotify.Remove):
+				o = opRemove
+			case ev.Has(fsnotify.Rename):
+				o = opMovedFrom
+			case ev.Has(fsnotify.Write):
+				o = opWrite
+			default:
+				continue
+			}
+			info, err := os.Stat(ev.Name)
+			b.events <- event{path: ev.Name, op: o, isDir: err == nil && info.IsDir()}
+
+		case err, ok := <-b.w.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				b.events <- event{op: opOverflow, source: b}
+				continue
+			}
+			b.errors <- err
+		}
+	}
+}
@@ -0,0 +1,210 @@
+//go:build linux
+
+package watcher
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask is the set of events requested for every watched directory.
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// inotifyBackend talks to inotify directly so it can report the move cookie
+// that ties IN_MOVED_FROM to IN_MOVED_TO, even across two watched directories.
+type inotifyBackend struct {
+	fd   int
+	file *os.File
+
+	mu      sync.Mutex
+	watches map[int32]string // watch descriptor → directory
+	paths   map[string]int32 // directory → watch descriptor
+
+	events chan event
+	errors chan error
+}
+
+func newInotifyBackend() (*inotifyBackend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	b := &inotifyBackend{
+		fd: fd,
+		// A non-blocking fd is registered with the runtime poller, so Close unblocks Read.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+		paths:   make(map[string]int32),
+		events:  make(chan event, 256),
+		errors:  make(chan error, 16),
+	}
+	go b.readLoop()
+	return b, nil
+}
+
+func (b *inotifyBackend) Name() string { return "inotify" }
+
+func (b *inotifyBackend) Add(dir string) error {
+	wd, err := unix.InotifyAddWatch(b.fd, dir, inotifyMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf("inotify watch limit reached (raise fs.inotify.max_user_watches): %w", err)
+		}
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The kernel returns the existing descriptor for an inode that is already
+	// watched, e.g. a directory that moved: forget its previous path.
+	if old, ok := b.watches[int32(wd)]; ok && old != dir {
+		delete(b.paths, old)
+	}
+	b.watches[int32(wd)] = dir
+	b.paths[dir] = int32(wd)
+	return nil
+}
+
+func (b *inotifyBackend) Remove(dir string) error {
+	b.mu.Lock()
+	wd, ok := b.paths[dir]
+	if ok {
+		delete(b.paths, dir)
+		delete(b.watches, wd)
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	if _, err := unix.InotifyRmWatch(b.fd, uint32(wd)); err != nil && !errors.Is(err, unix.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+func (b *inotifyBackend) Rename(oldDir, newDir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for wd, dir := range b.watches {
+		if !within(dir, oldDir) {
+			continue
+		}
+		moved := newDir + dir[len(oldDir):]
+		delete(b.paths, dir)
+		b.watches[wd] = moved
+		b.paths[moved] = wd
+	}
+	return nil
+}
+
+func (b *inotifyBackend) WatchList() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]string, 0, len(b.paths))
+	for dir := range b.paths {
+		out = append(out, dir)
+	}
+	return out
+}
+
+func (b *inotifyBackend) Events() <-chan event { return b.events }
+
+func (b *inotifyBackend) Errors() <-chan error { return b.errors }
+
+func (b *inotifyBackend) Close() error {
+	return b.file.Close()
+}
+
+func (b *inotifyBackend) readLoop() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				b.errors <- fmt.Errorf("read inotify events: %w", err)
+			}
+			return
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			cookie := binary.NativeEndian.Uint32(buf[off+8:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			off += unix.SizeofInotifyEvent
+
+			name := ""
+			if nameLen > 0 && off+nameLen <= n {
+				name = strings.TrimRight(string(buf[off:off+nameLen]), "\x00")
+			}
+			off += nameLen
+
+			b.dispatch(wd, mask, cookie, name)
+		}
+	}
+}
+
+func (b *inotifyBackend) dispatch(wd int32, mask, cookie uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		b.events <- event{op: opOverflow, source: b}
+		return
+	}
+
+	b.mu.Lock()
+	dir, ok := b.watches[wd]
+	if mask&unix.IN_IGNORED != 0 && ok {
+		// Watch removed by the kernel (directory deleted or unmounted).
+		// Watches dropped through Remove are already forgotten and not reported.
+		delete(b.watches, wd)
+		if b.paths[dir] == wd {
+			delete(b.paths, dir)
+		}
+	}
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		b.events <- event{path: dir, op: opUnwatched, isDir: true}
+		return
+	}
+	if name == "" {
+		return
+	}
+
+	ev := event{
+		path:   filepath.Join(dir, name),
+		isDir:  mask&unix.IN_ISDIR != 0,
+		cookie: cookie,
+	}
+	switch {
+	case mask&unix.IN_CREATE != 0:
+		ev.op = opCreate
+	case mask&unix.IN_DELETE != 0:
+		ev.op = opRemove
+	case mask&unix.IN_MOVED_FROM != 0:
+		ev.op = opMovedFrom
+	case mask&unix.IN_MOVED_TO != 0:
+		ev.op = opMovedTo
+	case mask&unix.IN_MODIFY != 0:
+		ev.op = opWrite
+	case mask&unix.IN_CLOSE_WRITE != 0:
+		ev.op = opCloseWrite
+	default:
+		return
+	}
+	b.events <- ev
+}
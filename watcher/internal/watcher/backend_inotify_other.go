@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watcher
+
+import "errors"
+
+func newInotifyBackend() (backend, error) {
+	return nil, errors.ErrUnsupported
+}
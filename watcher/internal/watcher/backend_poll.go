@@ -0,0 +1,331 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultPollInterval is how often polled directories are listed, unless the API
+// configures poll_interval_seconds.
+const defaultPollInterval = 30 * time.Second
+
+// pollEntry is what a listing remembers about a directory entry.
+type pollEntry struct {
+	dev, ino uint64
+	size     int64
+	mtime    time.Time
+	isDir    bool
+}
+
+// pollBackend lists its directories periodically and reports the differences
+// between two listings. It sees changes made by other hosts on NFS/SMB shares
+// and FUSE mounts, which inotify and fanotify do not report.
+//
+// A name whose inode shows up under another name in the same pass is reported as
+// a rename; a file whose size or mtime changed as a write. There is no close
+// event: written files are reported once the settle window elapses.
+type pollBackend struct {
+	mu       sync.Mutex
+	interval time.Duration
+	dirs     map[string]map[string]pollEntry // directory → name → entry
+	failing  map[string]bool                 // directories whose last listing failed
+
+	reset     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	events chan event
+	errors chan error
+}
+
+func newPollBackend(interval time.Duration) *pollBackend {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	b := &pollBackend{
+		interval: interval,
+		dirs:     make(map[string]map[string]pollEntry),
+		failing:  make(map[string]bool),
+		reset:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		events:   make(chan event, 256),
+		errors:   make(chan error, 16),
+	}
+	go b.loop()
+	return b
+}
+
+func (b *pollBackend) Name() string { return "poll" }
+
+// setInterval changes the polling interval, taking effect on the running loop.
+// d <= 0 restores the default.
+func (b *pollBackend) setInterval(d time.Duration) {
+	if d <= 0 {
+		d = defaultPollInterval
+	}
+	b.mu.Lock()
+	changed := d != b.interval
+	b.interval = d
+	b.mu.Unlock()
+
+	if changed {
+		select {
+		case b.reset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *pollBackend) Add(dir string) error {
+	b.mu.Lock()
+	_, ok := b.dirs[dir]
+	b.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	entries, err := listDir(dir)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.dirs[dir]; !ok {
+		b.dirs[dir] = entries
+	}
+	return nil
+}
+
+func (b *pollBackend) Remove(dir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.dirs, dir)
+	delete(b.failing, dir)
+	return nil
+}
+
+func (b *pollBackend) Rename(oldDir, newDir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for dir, entries := range b.dirs {
+		if !within(dir, oldDir) {
+			continue
+		}
+		delete(b.dirs, dir)
+		delete(b.failing, dir)
+		b.dirs[newDir+dir[len(oldDir):]] = entries
+	}
+	return nil
+}
+
+func (b *pollBackend) WatchList() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]string, 0, len(b.dirs))
+	for dir := range b.dirs {
+		out = append(out, dir)
+	}
+	return out
+}
+
+func (b *pollBackend) Events() <-chan event { return b.events }
+
+func (b *pollBackend) Errors() <-chan error { return b.errors }
+
+func (b *pollBackend) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	return nil
+}
+
+func (b *pollBackend) loop() {
+	defer close(b.events)
+	defer close(b.errors)
+
+	b.mu.Lock()
+	timer := time.NewTimer(b.interval)
+	b.mu.Unlock()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.reset:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+			b.poll()
+		}
+		b.mu.Lock()
+		timer.Reset(b.interval)
+		b.mu.Unlock()
+	}
+}
+
+// pollChange is an entry that appeared in or disappeared from a directory.
+type pollChange struct {
+	path  string
+	entry pollEntry
+}
+
+// poll lists every directory once and reports what changed since the last pass.
+func (b *pollBackend) poll() {
+	b.mu.Lock()
+	dirs := make([]string, 0, len(b.dirs))
+	for dir := range b.dirs {
+		dirs = append(dirs, dir)
+	}
+	b.mu.Unlock()
+	sort.Strings(dirs)
+
+	var removed, added []pollChange
+	var writes []string
+	for _, dir := range dirs {
+		entries, err := listDir(dir)
+
+		b.mu.Lock()
+		old, ok := b.dirs[dir]
+		if !ok {
+			// Removed or renamed while this pass was running
+			b.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			unwatched := b.listFailed(dir, err)
+			b.mu.Unlock()
+			if unwatched {
+				b.send(event{path: dir, op: opUnwatched, isDir: true})
+			}
+			continue
+		}
+		delete(b.failing, dir)
+		b.dirs[dir] = entries
+		b.mu.Unlock()
+
+		for name, prev := range old {
+			cur, ok := entries[name]
+			switch {
+			case !ok || cur.ino != prev.ino || cur.dev != prev.dev || cur.isDir != prev.isDir:
+				removed = append(removed, pollChange{filepath.Join(dir, name), prev})
+				if ok {
+					// Replaced by another file under the same name
+					added = append(added, pollChange{filepath.Join(dir, name), cur})
+				}
+			case !cur.isDir && (cur.size != prev.size || !cur.mtime.Equal(prev.mtime)):
+				writes = append(writes, filepath.Join(dir, name))
+			}
+		}
+		for name, cur := range entries {
+			if _, ok := old[name]; !ok {
+				added = append(added, pollChange{filepath.Join(dir, name), cur})
+			}
+		}
+	}
+
+	b.report(removed, added, writes)
+}
+
+// listFailed handles a directory that could not be listed. A directory gone from a
+// watched parent is reported by the parent's listing; a watched root that is gone
+// is forgotten and true is returned, to report it as unwatched. Other errors are
+// reported once until a listing succeeds. Called with b.mu held.
+func (b *pollBackend) listFailed(dir string, err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, ok := b.dirs[filepath.Dir(dir)]; ok {
+			return false
+		}
+		delete(b.dirs, dir)
+		delete(b.failing, dir)
+		return true
+	}
+	if !b.failing[dir] {
+		b.failing[dir] = true
+		select {
+		case b.errors <- fmt.Errorf("poll %s: %w", dir, err):
+		default:
+		}
+	}
+	return false
+}
+
+// report sends the changes of one pass. An inode that disappeared under one name
+// and appeared under another is a rename; renamed directories come first so their
+// contents are re-keyed before anything below them is reported.
+func (b *pollBackend) report(removed, added []pollChange, writes []string) {
+	type fileKey struct{ dev, ino uint64 }
+	gone := make(map[fileKey]pollChange, len(removed))
+	for _, r := range removed {
+		gone[fileKey{r.entry.dev, r.entry.ino}] = r
+	}
+
+	var creates []pollChange
+	moved := make(map[string]bool)
+	sort.SliceStable(added, func(i, j int) bool { return added[i].entry.isDir && !added[j].entry.isDir })
+	for _, a := range added {
+		key := fileKey{a.entry.dev, a.entry.ino}
+		from, ok := gone[key]
+		if !ok || a.entry.ino == 0 || from.entry.isDir != a.entry.isDir {
+			creates = append(creates, a)
+			continue
+		}
+		delete(gone, key)
+		moved[from.path] = true
+		cookie := nextCookie()
+		b.send(event{path: from.path, op: opMovedFrom, isDir: from.entry.isDir, cookie: cookie})
+		b.send(event{path: a.path, op: opMovedTo, isDir: a.entry.isDir, cookie: cookie})
+	}
+
+	for _, r := range removed {
+		if !moved[r.path] {
+			b.send(event{path: r.path, op: opRemove, isDir: r.entry.isDir})
+		}
+	}
+	for _, c := range creates {
+		b.send(event{path: c.path, op: opCreate, isDir: c.entry.isDir})
+	}
+	for _, path := range writes {
+		b.send(event{path: path, op: opWrite})
+	}
+}
+
+// send delivers an event unless the backend is closing.
+func (b *pollBackend) send(ev event) {
+	select {
+	case b.events <- ev:
+	case <-b.done:
+	}
+}
+
+// listDir returns the entries of dir keyed by name.
+func listDir(dir string) (map[string]pollEntry, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]pollEntry, len(des))
+	for _, de := range des {
+		info, err := de.Info()
+		if err != nil {
+			// Removed since ReadDir; the next pass will not see it either
+			continue
+		}
+		e := pollEntry{size: info.Size(), mtime: info.ModTime(), isDir: info.IsDir()}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			e.dev, e.ino = uint64(st.Dev), st.Ino
+		}
+		entries[de.Name()] = e
+	}
+	return entries, nil
+}
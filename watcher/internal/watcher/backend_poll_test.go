@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
+)
+
+func TestPoll_CreateModifyDelete(t *testing.T) {
+	root := t.TempDir()
+	_, rec := startWatcher(t, newPollBackend(50*time.Millisecond), root)
+
+	path := filepath.Join(root, "movie.mkv")
+	writeFile(t, path)
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != path {
+		t.Errorf("created path = %s, want %s", p, path)
+	}
+
+	if err := os.WriteFile(path, []byte("longer data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvents(t, rec, "file.modified", 1)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	deleted := waitForEvents(t, rec, "file.deleted", 1)
+	if p := deleted[0].Data.(models.FileDeletedData).Path; p != path {
+		t.Errorf("deleted path = %s, want %s", p, path)
+	}
+}
+
+func TestPoll_RenamePairsByInode(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "incoming"), filepath.Join(root, "movies")
+	for _, d := range []string{src, dst} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPath, newPath := filepath.Join(src, "film.mkv"), filepath.Join(dst, "Film (2024).mkv")
+	writeFile(t, oldPath)
+	_, rec := startWatcher(t, newPollBackend(50*time.Millisecond), root)
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	events := waitForEvents(t, rec, "file.renamed", 1)
+	data := events[0].Data.(models.FileRenamedData)
+	if data.OldPath != oldPath || data.NewPath != newPath {
+		t.Errorf("renamed %s → %s, want %s → %s", data.OldPath, data.NewPath, oldPath, newPath)
+	}
+	if n := len(rec.EventsOfType("file.deleted")) + len(rec.EventsOfType("file.created")); n != 0 {
+		t.Errorf("got %d created/deleted events, want none for a rename", n)
+	}
+}
+
+func TestPoll_DirectoryRename(t *testing.T) {
+	root := t.TempDir()
+	oldDir, newDir := filepath.Join(root, "Film"), filepath.Join(root, "Film (2024)")
+	if err := os.Mkdir(oldDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(oldDir, "film.mkv"))
+	_, rec := startWatcher(t, newPollBackend(50*time.Millisecond), root)
+
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+	events := waitForEvents(t, rec, "file.renamed", 1)
+	if p := events[0].Data.(models.FileRenamedData).NewPath; p != filepath.Join(newDir, "film.mkv") {
+		t.Errorf("renamed to %s, want %s", p, filepath.Join(newDir, "film.mkv"))
+	}
+
+	// The listing moved with the directory: new files are still seen, old ones are not re-announced.
+	writeFile(t, filepath.Join(newDir, "extra.mkv"))
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != filepath.Join(newDir, "extra.mkv") {
+		t.Errorf("created path = %s, want %s", p, filepath.Join(newDir, "extra.mkv"))
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := len(rec.EventsOfType("file.created")) + len(rec.EventsOfType("file.deleted")); n != 1 {
+		t.Errorf("got %d created/deleted events, want only the new file (all events: %v)", n, rec.Events())
+	}
+}
+
+func TestFileWatcher_PollModeSelectedPerPath(t *testing.T) {
+	polled, native := t.TempDir(), t.TempDir()
+
+	rec := publisher.NewRecorder()
+	w, err := New(rec, []string{polled, native})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetSettleWindow(100 * time.Millisecond)
+	w.SetPollInterval(50 * time.Millisecond)
+	w.SetPathModes(map[string]string{polled: "poll"})
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+
+	if got := w.poll.WatchList(); len(got) != 1 || got[0] != polled {
+		t.Errorf("polled directories = %v, want [%s]", got, polled)
+	}
+	writeFile(t, filepath.Join(polled, "movie.mkv"))
+	waitForEvents(t, rec, "file.created", 1)
+
+	// Switching the mode moves the watch to the native backend
+	w.SetPathModes(map[string]string{polled: "native"})
+	if got := w.poll.WatchList(); len(got) != 0 {
+		t.Errorf("polled directories = %v after switching to native, want none", got)
+	}
+}
+
+func TestModeOf_ClosestWatchPath(t *testing.T) {
+	modes := map[string]watchMode{"/mnt/media": modeNative, "/mnt/media/nas": modePoll}
+	for dir, want := range map[string]watchMode{
+		"/mnt/media":           modeNative,
+		"/mnt/media/movies":    modeNative,
+		"/mnt/media/nas":       modePoll,
+		"/mnt/media/nas/shows": modePoll,
+		"/mnt/media/nas2":      modeNative,
+		"/srv":                 modeAuto,
+	} {
+		if got := modeOf(modes, dir); got != want {
+			t.Errorf("modeOf(%s) = %s, want %s", dir, got, want)
+		}
+	}
+}
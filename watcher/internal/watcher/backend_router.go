@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// routedBackend spreads directories over several backends: each directory goes to
+// the first backend that accepts it. A backend declines a directory by returning
+// an error wrapping errors.ErrUnsupported from Add, e.g. fanotify for a filesystem
+// it cannot mark.
+type routedBackend struct {
+	backends []backend
+
+	// route, if set, narrows the backends tried for a directory, in order.
+	route func(dir string) []backend
+
+	mu    sync.Mutex
+	owner map[string]backend // directory → backend watching it
+
+	events chan event
+	errors chan error
+	wg     sync.WaitGroup
+}
+
+func newRoutedBackend(backends ...backend) *routedBackend {
+	r := &routedBackend{
+		backends: backends,
+		owner:    make(map[string]backend),
+		events:   make(chan event, 256),
+		errors:   make(chan error, 16),
+	}
+	for _, b := range backends {
+		r.wg.Add(2)
+		go func(b backend) {
+			defer r.wg.Done()
+			for ev := range b.Events() {
+				r.events <- ev
+			}
+		}(b)
+		go func(b backend) {
+			defer r.wg.Done()
+			for err := range b.Errors() {
+				r.errors <- err
+			}
+		}(b)
+	}
+	go func() {
+		r.wg.Wait()
+		close(r.events)
+		close(r.errors)
+	}()
+	return r
+}
+
+func (r *routedBackend) Name() string {
+	names := make([]string, len(r.backends))
+	for i, b := range r.backends {
+		names[i] = b.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (r *routedBackend) Add(dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.owner[dir]; ok {
+		return b.Add(dir)
+	}
+	candidates := r.backends
+	if r.route != nil {
+		candidates = r.route(dir)
+	}
+	var err error
+	for _, b := range candidates {
+		if err = b.Add(dir); errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		if err == nil {
+			r.owner[dir] = b
+		}
+		return err
+	}
+	return err
+}
+
+func (r *routedBackend) Remove(dir string) error {
+	r.mu.Lock()
+	b, ok := r.owner[dir]
+	delete(r.owner, dir)
+	r.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return b.Remove(dir)
+}
+
+func (r *routedBackend) Rename(oldDir, newDir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	involved := make(map[backend]bool)
+	for dir, b := range r.owner {
+		if within(dir, oldDir) {
+			involved[b] = true
+		}
+	}
+	for b := range involved {
+		if err := b.Rename(oldDir, newDir); err != nil {
+			return err
+		}
+	}
+	for dir, b := range r.owner {
+		if within(dir, oldDir) {
+			delete(r.owner, dir)
+			r.owner[newDir+dir[len(oldDir):]] = b
+		}
+	}
+	return nil
+}
+
+func (r *routedBackend) WatchList() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0, len(r.owner))
+	for dir := range r.owner {
+		out = append(out, dir)
+	}
+	return out
+}
+
+func (r *routedBackend) Events() <-chan event { return r.events }
+
+func (r *routedBackend) Errors() <-chan error { return r.errors }
+
+func (r *routedBackend) Close() error {
+	var errs []error
+	for _, b := range r.backends {
+		errs = append(errs, b.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package watcher
+
+import (
+	"errors"
+	"testing"
+)
+
+// stubBackend records the directories it watches and declines those in decline.
+type stubBackend struct {
+	name    string
+	decline map[string]bool
+	dirs    map[string]bool
+	events  chan event
+	errors  chan error
+}
+
+func newStubBackend(name string, decline ...string) *stubBackend {
+	b := &stubBackend{
+		name:    name,
+		decline: make(map[string]bool),
+		dirs:    make(map[string]bool),
+		events:  make(chan event),
+		errors:  make(chan error),
+	}
+	for _, d := range decline {
+		b.decline[d] = true
+	}
+	return b
+}
+
+func (b *stubBackend) Name() string { return b.name }
+
+func (b *stubBackend) Add(dir string) error {
+	if b.decline[dir] {
+		return errors.ErrUnsupported
+	}
+	b.dirs[dir] = true
+	return nil
+}
+
+func (b *stubBackend) Remove(dir string) error {
+	delete(b.dirs, dir)
+	return nil
+}
+
+func (b *stubBackend) Rename(oldDir, newDir string) error {
+	for dir := range b.dirs {
+		if within(dir, oldDir) {
+			delete(b.dirs, dir)
+			b.dirs[newDir+dir[len(oldDir):]] = true
+		}
+	}
+	return nil
+}
+
+func (b *stubBackend) WatchList() []string {
+	out := make([]string, 0, len(b.dirs))
+	for dir := range b.dirs {
+		out = append(out, dir)
+	}
+	return out
+}
+
+func (b *stubBackend) Events() <-chan event { return b.events }
+
+func (b *stubBackend) Errors() <-chan error { return b.errors }
+
+func (b *stubBackend) Close() error {
+	close(b.events)
+	close(b.errors)
+	return nil
+}
+
+func TestRoutedBackend_FallsBackWhenDeclined(t *testing.T) {
+	whole := newStubBackend("whole", "/mnt/nfs", "/mnt/nfs/movies")
+	perDir := newStubBackend("perdir")
+	r := newRoutedBackend(whole, perDir)
+	defer r.Close()
+
+	for _, dir := range []string{"/data", "/data/movies", "/mnt/nfs", "/mnt/nfs/movies"} {
+		if err := r.Add(dir); err != nil {
+			t.Fatalf("Add(%s) returned error: %v", dir, err)
+		}
+	}
+	if !whole.dirs["/data/movies"] || perDir.dirs["/data/movies"] {
+		t.Errorf("/data/movies should be watched by the first backend only")
+	}
+	if whole.dirs["/mnt/nfs/movies"] || !perDir.dirs["/mnt/nfs/movies"] {
+		t.Errorf("/mnt/nfs/movies should fall back to the second backend")
+	}
+
+	if err := r.Rename("/mnt/nfs", "/mnt/nfs2"); err != nil {
+		t.Fatal(err)
+	}
+	if !perDir.dirs["/mnt/nfs2/movies"] {
+		t.Errorf("rename not applied to the owning backend: %v", perDir.WatchList())
+	}
+	if err := r.Remove("/mnt/nfs2/movies"); err != nil {
+		t.Fatal(err)
+	}
+	if perDir.dirs["/mnt/nfs2/movies"] {
+		t.Errorf("remove not applied to the owning backend")
+	}
+	if got := len(r.WatchList()); got != 3 {
+		t.Errorf("WatchList() has %d directories, want 3", got)
+	}
+	if r.Name() != "whole+perdir" {
+		t.Errorf("Name() = %q, want whole+perdir", r.Name())
+	}
+}
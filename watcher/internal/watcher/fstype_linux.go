@@ -0,0 +1,29 @@
+//go:build linux
+
+package watcher
+
+import "golang.org/x/sys/unix"
+
+// Magic numbers (statfs f_type) of network filesystems: changes made on other
+// hosts never reach the local inotify/fanotify queues.
+var networkFSTypes = map[uint32]string{
+	unix.NFS_SUPER_MAGIC:  "nfs",
+	unix.SMB_SUPER_MAGIC:  "smb",
+	unix.CIFS_SUPER_MAGIC: "cifs",
+	0xfe534d42:            "smb2",
+	unix.V9FS_MAGIC:       "9p",
+	unix.AFS_SUPER_MAGIC:  "afs",
+	0x00c36400:            "ceph",
+	unix.CODA_SUPER_MAGIC: "coda",
+	unix.NCP_SUPER_MAGIC:  "ncp",
+}
+
+// networkFS returns the type of the network filesystem holding dir, or "" if dir
+// is on a local filesystem (or cannot be checked).
+func networkFS(dir string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	return networkFSTypes[uint32(st.Type)]
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package watcher
+
+// networkFS is only implemented on Linux; elsewhere "auto" always picks native watches.
+func networkFS(dir string) string {
+	return ""
+}
@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mediaIndex is the in-memory tree of directories and media files known under the
+// watched roots. Directory events carry no information about their contents, so
+// renames and removals of whole folders are resolved against it.
+type mediaIndex struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]struct{} // directory → names of its media files
+}
+
+// movedFile is a media file whose path changed with its directory.
+type movedFile struct {
+	oldPath string
+	newPath string
+}
+
+func newMediaIndex() *mediaIndex {
+	return &mediaIndex{dirs: make(map[string]map[string]struct{})}
+}
+
+// addDir records a directory, with no media files yet if it is new.
+func (x *mediaIndex) addDir(dir string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.dirs[dir]; !ok {
+		x.dirs[dir] = make(map[string]struct{})
+	}
+}
+
+// add records a media file. Returns false if it was already known.
+func (x *mediaIndex) add(path string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	files, ok := x.dirs[dir]
+	if !ok {
+		files = make(map[string]struct{})
+		x.dirs[dir] = files
+	}
+	if _, known := files[name]; known {
+		return false
+	}
+	files[name] = struct{}{}
+	return true
+}
+
+// remove forgets a media file. Returns false if it was not known.
+func (x *mediaIndex) remove(path string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	dir, name := filepath.Split(path)
+	files, ok := x.dirs[filepath.Clean(dir)]
+	if !ok {
+		return false
+	}
+	if _, known := files[name]; !known {
+		return false
+	}
+	delete(files, name)
+	return true
+}
+
+// has reports whether path is a known media file.
+func (x *mediaIndex) has(path string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	dir, name := filepath.Split(path)
+	_, ok := x.dirs[filepath.Clean(dir)][name]
+	return ok
+}
+
+// hasDir reports whether dir is a known directory.
+func (x *mediaIndex) hasDir(dir string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_, ok := x.dirs[dir]
+	return ok
+}
+
+// moveDir re-keys oldDir and everything below it under newDir, and returns the
+// media files that moved, sorted by old path.
+func (x *mediaIndex) moveDir(oldDir, newDir string) []movedFile {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var moved []movedFile
+	for dir, files := range x.dirs {
+		if !within(dir, oldDir) {
+			continue
+		}
+		target := newDir + dir[len(oldDir):]
+		for name := range files {
+			moved = append(moved, movedFile{
+				oldPath: filepath.Join(dir, name),
+				newPath: filepath.Join(target, name),
+			})
+		}
+		delete(x.dirs, dir)
+		x.dirs[target] = files
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i].oldPath < moved[j].oldPath })
+	return moved
+}
+
+// removeDir forgets dir and everything below it, and returns the media files it
+// contained, sorted by path.
+func (x *mediaIndex) removeDir(dir string) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var removed []string
+	for d, files := range x.dirs {
+		if !within(d, dir) {
+			continue
+		}
+		for name := range files {
+			removed = append(removed, filepath.Join(d, name))
+		}
+		delete(x.dirs, d)
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// forgetDir forgets dir itself and its media files, but not the directories below
+// it, e.g. when dir stops being watched while a nested watch path keeps those.
+func (x *mediaIndex) forgetDir(dir string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.dirs, dir)
+}
+
+// within reports whether path is dir or lies below it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,43 @@
+package watcher
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMediaIndex_MoveDir(t *testing.T) {
+	x := newMediaIndex()
+	x.add("/media/a/film.mkv")
+	x.add("/media/a/sub/extra.mkv")
+	x.add("/media/ab/other.mkv") // shares the prefix but is not below /media/a
+
+	moved := x.moveDir("/media/a", "/media/b")
+	want := []movedFile{
+		{oldPath: "/media/a/film.mkv", newPath: "/media/b/film.mkv"},
+		{oldPath: "/media/a/sub/extra.mkv", newPath: "/media/b/sub/extra.mkv"},
+	}
+	if !slices.Equal(moved, want) {
+		t.Errorf("moveDir() = %v, want %v", moved, want)
+	}
+	if !x.has("/media/b/sub/extra.mkv") || x.has("/media/a/film.mkv") {
+		t.Error("index not re-keyed under the new directory")
+	}
+	if !x.has("/media/ab/other.mkv") {
+		t.Error("sibling directory with a common prefix was moved")
+	}
+}
+
+func TestMediaIndex_RemoveDir(t *testing.T) {
+	x := newMediaIndex()
+	x.add("/media/a/film.mkv")
+	x.add("/media/a/sub/extra.mkv")
+	x.add("/media/b/keep.mkv")
+
+	removed := x.removeDir("/media/a")
+	if want := []string{"/media/a/film.mkv", "/media/a/sub/extra.mkv"}; !slices.Equal(removed, want) {
+		t.Errorf("removeDir() = %v, want %v", removed, want)
+	}
+	if x.hasDir("/media/a/sub") || !x.has("/media/b/keep.mkv") {
+		t.Error("removeDir() removed the wrong entries")
+	}
+}
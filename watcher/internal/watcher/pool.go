@@ -0,0 +1,59 @@
+package watcher
+
+import "sync"
+
+// hashWorkers bounds the partial hashes computed concurrently for live events,
+// so a burst of finished downloads does not saturate the disks.
+const hashWorkers = 2
+
+// hashQueue bounds the settled files waiting for a hash worker.
+const hashQueue = 1024
+
+// workPool runs jobs on a fixed number of goroutines with a bounded queue.
+type workPool struct {
+	jobs     chan func()
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newWorkPool(workers, queue int) *workPool {
+	p := &workPool{
+		jobs: make(chan func(), queue),
+		done: make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+// submit queues a job. Returns false if the queue is full or the pool stopped.
+func (p *workPool) submit(job func()) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop makes the workers exit; queued jobs are dropped.
+func (p *workPool) stop() {
+	p.stopOnce.Do(func() { close(p.done) })
+}
+
+func (p *workPool) run() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case job := <-p.jobs:
+			job()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package watcher
+
+import (
+	"sort"
+	"sync"
+)
+
+// watchRegistry records the watch paths (roots) and the directories watched for
+// them. Roots may overlap: a directory under two nested roots is watched once,
+// and stays watched until no root holds it any more.
+type watchRegistry struct {
+	mu    sync.Mutex
+	roots []string            // in the order they were added
+	dirs  map[string]struct{} // watched directories
+}
+
+func newWatchRegistry() *watchRegistry {
+	return &watchRegistry{dirs: make(map[string]struct{})}
+}
+
+// addRoot records a watch path. Returns false if it was already there.
+func (r *watchRegistry) addRoot(root string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.roots {
+		if p == root {
+			return false
+		}
+	}
+	r.roots = append(r.roots, root)
+	return true
+}
+
+// removeRoot forgets a watch path and returns the directories no other root holds,
+// which are forgotten too, sorted. Returns false if root was not a watch path.
+func (r *watchRegistry) removeRoot(root string) ([]string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := -1
+	for j, p := range r.roots {
+		if p == root {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return nil, false
+	}
+	r.roots = append(r.roots[:i:i], r.roots[i+1:]...)
+
+	var orphans []string
+	for dir := range r.dirs {
+		if within(dir, root) && !r.heldLocked(dir) {
+			orphans = append(orphans, dir)
+			delete(r.dirs, dir)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, true
+}
+
+// heldLocked reports whether path lies under a watch path. Called with r.mu held.
+func (r *watchRegistry) heldLocked(path string) bool {
+	for _, root := range r.roots {
+		if within(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// rootList returns the watch paths.
+func (r *watchRegistry) rootList() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.roots...)
+}
+
+// addDir records a watched directory.
+func (r *watchRegistry) addDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dirs[dir] = struct{}{}
+}
+
+// removeTree forgets dir and every watched directory below it, and returns them.
+func (r *watchRegistry) removeTree(dir string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var removed []string
+	for d := range r.dirs {
+		if within(d, dir) {
+			removed = append(removed, d)
+			delete(r.dirs, d)
+		}
+	}
+	return removed
+}
+
+// renameTree re-keys dir and every watched directory below it after dir moved.
+func (r *watchRegistry) renameTree(oldDir, newDir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for d := range r.dirs {
+		if within(d, oldDir) {
+			delete(r.dirs, d)
+			r.dirs[newDir+d[len(oldDir):]] = struct{}{}
+		}
+	}
+}
+
+// rootsHolding returns the watch paths holding any of dirs, without those nested
+// in another returned root (rescanning the outer one covers them), sorted.
+func (r *watchRegistry) rootsHolding(dirs []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := make(map[string]bool)
+	for _, dir := range dirs {
+		for _, root := range r.roots {
+			if within(dir, root) {
+				held[root] = true
+			}
+		}
+	}
+	return outermost(held)
+}
+
+// dirsUnder returns the watched directories at or below dir.
+func (r *watchRegistry) dirsUnder(dir string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []string
+	for d := range r.dirs {
+		if within(d, dir) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// outermost returns the paths of set not lying below another path of set, sorted.
+func outermost(set map[string]bool) []string {
+	var out []string
+	for p := range set {
+		nested := false
+		for q := range set {
+			if q != p && within(p, q) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// rootsOf returns the watch paths holding path.
+func (r *watchRegistry) rootsOf(path string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []string
+	for _, root := range r.roots {
+		if within(path, root) {
+			out = append(out, root)
+		}
+	}
+	return out
+}
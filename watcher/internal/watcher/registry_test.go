@@ -0,0 +1,49 @@
+package watcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWatchRegistry_RemoveRootKeepsNestedRoot(t *testing.T) {
+	r := newWatchRegistry()
+	r.addRoot("/media")
+	r.addRoot("/media/movies")
+	if r.addRoot("/media") {
+		t.Error("addRoot accepted a duplicate watch path")
+	}
+	for _, d := range []string{"/media", "/media/shows", "/media/movies", "/media/movies/Film"} {
+		r.addDir(d)
+	}
+
+	orphans, ok := r.removeRoot("/media")
+	if !ok {
+		t.Fatal("removeRoot(/media) = false")
+	}
+	if want := []string{"/media", "/media/shows"}; !reflect.DeepEqual(orphans, want) {
+		t.Errorf("orphans = %v, want %v", orphans, want)
+	}
+
+	orphans, _ = r.removeRoot("/media/movies")
+	if want := []string{"/media/movies", "/media/movies/Film"}; !reflect.DeepEqual(orphans, want) {
+		t.Errorf("orphans = %v, want %v", orphans, want)
+	}
+	if _, ok := r.removeRoot("/media/movies"); ok {
+		t.Error("removeRoot succeeded twice")
+	}
+}
+
+func TestWatchRegistry_RemoveInnerRootKeepsOuter(t *testing.T) {
+	r := newWatchRegistry()
+	r.addRoot("/media")
+	r.addRoot("/media/movies")
+	r.addDir("/media")
+	r.addDir("/media/movies")
+
+	if orphans, _ := r.removeRoot("/media/movies"); len(orphans) != 0 {
+		t.Errorf("orphans = %v, want none: /media still holds them", orphans)
+	}
+	if got := r.rootList(); !reflect.DeepEqual(got, []string{"/media"}) {
+		t.Errorf("roots = %v, want [/media]", got)
+	}
+}
@@ -0,0 +1,225 @@
+package watcher
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultSettleWindow is how long a file must see no write before it is reported,
+// unless the API configures settle_window_ms.
+const defaultSettleWindow = 5 * time.Second
+
+// settleConfirm bounds the final check that size and mtime stopped changing.
+// It is also how long a file closed by its writer (IN_CLOSE_WRITE) waits.
+const settleConfirm = time.Second
+
+// settleKind is the event a settling file will be reported with.
+type settleKind int
+
+const (
+	settleCreated settleKind = iota
+	settleModified
+)
+
+// settling is the state of a file being written.
+type settling struct {
+	path  string
+	kind  settleKind
+	timer *time.Timer
+
+	// size and mtime are the last stat snapshot; stable once a check matches them.
+	size  int64
+	mtime time.Time
+	snap  bool
+
+	// hashing is set once the file is stable and queued for its partial hash.
+	// gen counts writes, so a hash started before the latest write is discarded.
+	hashing bool
+	gen     uint64
+}
+
+// settler holds back file.created / file.modified until a file is finished.
+//
+// Every create or write re-arms a quiet window. When the window (or the shorter
+// settleConfirm after the writer closed the file) elapses, the file is stat'ed:
+// if size and mtime match the previous snapshot it is hashed on the pool and
+// reported once, otherwise the snapshot is refreshed and checked again after
+// settleConfirm. The file stays tracked while it is hashed, so a write, rename
+// or delete in the meantime is handled as if it were still settling.
+type settler struct {
+	mu     sync.Mutex
+	window time.Duration
+	files  map[string]*settling
+	emit   func(path string, kind settleKind, partialHash string)
+
+	hash func(path string) (string, error)
+	pool *workPool
+}
+
+func newSettler(emit func(path string, kind settleKind, partialHash string), hash func(string) (string, error), pool *workPool) *settler {
+	return &settler{
+		window: defaultSettleWindow,
+		files:  make(map[string]*settling),
+		emit:   emit,
+		hash:   hash,
+		pool:   pool,
+	}
+}
+
+// setWindow changes the quiet window. d <= 0 restores the default.
+func (s *settler) setWindow(d time.Duration) {
+	if d <= 0 {
+		d = defaultSettleWindow
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.window = d
+}
+
+// touch records write activity on path. A file first seen through a create stays
+// a creation however many writes follow.
+func (s *settler) touch(path string, kind settleKind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.files[path]; ok {
+		st.gen++
+		st.hashing = false
+		st.timer.Reset(s.window)
+		return
+	}
+	st := &settling{path: path, kind: kind}
+	st.timer = time.AfterFunc(s.window, func() { s.check(st) })
+	s.files[path] = st
+}
+
+// closed records that the writer closed path; it is reported after a short confirmation.
+func (s *settler) closed(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.files[path]
+	if !ok || st.hashing {
+		return
+	}
+	s.snapshot(st)
+	st.timer.Reset(min(s.window, settleConfirm))
+}
+
+// cancel forgets path, e.g. because it was deleted before it settled.
+func (s *settler) cancel(path string) (settleKind, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.files[path]
+	if !ok {
+		return 0, false
+	}
+	st.timer.Stop()
+	delete(s.files, path)
+	return st.kind, true
+}
+
+// cancelDir forgets every file directly in dir, e.g. because dir is no longer watched.
+func (s *settler) cancelDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path, st := range s.files {
+		if filepath.Dir(path) == dir {
+			st.timer.Stop()
+			delete(s.files, path)
+		}
+	}
+}
+
+// rename moves the pending state of oldPath to newPath.
+func (s *settler) rename(oldPath, newPath string) (settleKind, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.files[oldPath]
+	if !ok {
+		return 0, false
+	}
+	delete(s.files, oldPath)
+	st.path = newPath
+	s.files[newPath] = st
+	return st.kind, true
+}
+
+func (s *settler) check(st *settling) {
+	s.mu.Lock()
+	if s.files[st.path] != st || st.hashing {
+		s.mu.Unlock()
+		return
+	}
+	prevSize, prevMtime, hadSnap := st.size, st.mtime, st.snap
+	if !s.snapshot(st) {
+		// Gone without a delete event reaching us yet; the delete will be reported on its own.
+		delete(s.files, st.path)
+		s.mu.Unlock()
+		return
+	}
+	if !hadSnap || st.size != prevSize || !st.mtime.Equal(prevMtime) {
+		st.timer.Reset(min(s.window, settleConfirm))
+		s.mu.Unlock()
+		return
+	}
+	st.hashing = true
+	gen, path := st.gen, st.path
+	s.mu.Unlock()
+
+	if !s.pool.submit(func() { s.finish(st, gen, true) }) {
+		slog.Debug("Hash queue full, reporting file without partial hash", "path", path)
+		s.finish(st, gen, false)
+	}
+}
+
+// finish hashes a settled file and reports it, unless it was written, deleted or
+// settled again in the meantime.
+func (s *settler) finish(st *settling, gen uint64, withHash bool) {
+	var partialHash string
+	for {
+		s.mu.Lock()
+		path := st.path
+		s.mu.Unlock()
+
+		var err error
+		partialHash = ""
+		if withHash {
+			if partialHash, err = s.hash(path); err != nil {
+				slog.Debug("Failed to compute partial hash", "path", path, "error", err)
+			}
+		}
+
+		s.mu.Lock()
+		if s.files[st.path] != st || st.gen != gen || !st.hashing {
+			s.mu.Unlock()
+			return
+		}
+		if st.path != path {
+			// Renamed while hashing: hash again under the new name.
+			s.mu.Unlock()
+			continue
+		}
+		delete(s.files, path)
+		s.mu.Unlock()
+
+		s.emit(path, st.kind, partialHash)
+		return
+	}
+}
+
+// snapshot refreshes the stat snapshot of st. Returns false if the file is gone.
+func (s *settler) snapshot(st *settling) bool {
+	info, err := os.Stat(st.path)
+	if err != nil {
+		return false
+	}
+	st.size, st.mtime, st.snap = info.Size(), info.ModTime(), true
+	return true
+}
@@ -0,0 +1,234 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/hash"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+func TestSettle_SlowWriteEmitsSingleCreated(t *testing.T) {
+	root := t.TempDir()
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w, rec := startWatcher(t, b, root)
+	w.SetSettleWindow(300 * time.Millisecond)
+
+	path := filepath.Join(root, "movie.mkv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := f.Write(make([]byte, 64*1024)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if n := len(rec.EventsOfType("file.created")); n != 0 {
+			t.Fatalf("file.created sent while the file was still being written")
+		}
+	}
+	_ = f.Close()
+
+	created := waitForEvents(t, rec, "file.created", 1)
+	if size := created[0].Data.(models.FileCreatedData).SizeBytes; size != 5*64*1024 {
+		t.Errorf("size_bytes = %d, want the final size %d", size, 5*64*1024)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if n := len(rec.EventsOfType("file.created")); n != 1 {
+		t.Errorf("got %d file.created events, want 1", n)
+	}
+	if n := len(rec.EventsOfType("file.modified")); n != 0 {
+		t.Errorf("got %d file.modified events, want 0", n)
+	}
+}
+
+func TestSettle_CloseWriteShortensWait(t *testing.T) {
+	root := t.TempDir()
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w, rec := startWatcher(t, b, root)
+	w.SetSettleWindow(time.Minute)
+
+	writeFile(t, filepath.Join(root, "movie.mkv"))
+
+	start := time.Now()
+	waitForEvents(t, rec, "file.created", 1)
+	if elapsed := time.Since(start); elapsed > 2*settleConfirm+time.Second {
+		t.Errorf("file.created took %v after close, want about %v", elapsed, settleConfirm)
+	}
+}
+
+func TestSettle_ModifiedOnceAfterWrites(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "movie.mkv")
+	writeFile(t, path)
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		_, _ = f.Write([]byte("more"))
+	}
+	_ = f.Close()
+
+	waitForEvents(t, rec, "file.modified", 1)
+	time.Sleep(300 * time.Millisecond)
+	if n := len(rec.EventsOfType("file.modified")); n != 1 {
+		t.Errorf("got %d file.modified events, want 1", n)
+	}
+	if n := len(rec.EventsOfType("file.created")); n != 0 {
+		t.Errorf("got %d file.created events for an existing file, want 0", n)
+	}
+}
+
+func TestSettle_CreatedThenDeletedIsSilent(t *testing.T) {
+	root := t.TempDir()
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w, rec := startWatcher(t, b, root)
+	w.SetSettleWindow(300 * time.Millisecond)
+
+	path := filepath.Join(root, "sample.mkv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(path)
+	_ = f.Close()
+
+	time.Sleep(time.Second)
+	if events := rec.Events(); len(events) != 0 {
+		t.Errorf("got %v, want no events for a file removed before it settled", events)
+	}
+}
+
+func TestSettle_RenamedWhileWritingIsCreatedUnderFinalName(t *testing.T) {
+	root := t.TempDir()
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	first, final := filepath.Join(root, "movie.mkv"), filepath.Join(root, "Movie (2024).mkv")
+	writeFile(t, first)
+	if err := os.Rename(first, final); err != nil {
+		t.Fatal(err)
+	}
+
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != final {
+		t.Errorf("created path = %s, want %s", p, final)
+	}
+	if n := len(rec.EventsOfType("file.renamed")); n != 0 {
+		t.Errorf("got %d file.renamed events, want 0", n)
+	}
+}
+
+func TestSettle_CreatedCarriesPartialHash(t *testing.T) {
+	root := t.TempDir()
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	path := filepath.Join(root, "movie.mkv")
+	writeFile(t, path)
+
+	created := waitForEvents(t, rec, "file.created", 1)
+	want, err := hash.Calculate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := created[0].Data.(models.FileCreatedData).PartialHash; got != want {
+		t.Errorf("partial_hash = %q, want %q", got, want)
+	}
+}
+
+func TestSettler_WriteDuringHashRestartsSettling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(path, []byte("part one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashStarted, release := make(chan struct{}), make(chan struct{})
+	var calls int
+	hashFn := func(string) (string, error) {
+		calls++
+		if calls == 1 {
+			close(hashStarted)
+			<-release
+			return "stale", nil
+		}
+		return "fresh", nil
+	}
+
+	var mu sync.Mutex
+	var emitted []string
+	pool := newWorkPool(1, 8)
+	defer pool.stop()
+	s := newSettler(func(path string, kind settleKind, partialHash string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if kind != settleCreated {
+			t.Errorf("kind = %v, want settleCreated", kind)
+		}
+		emitted = append(emitted, partialHash)
+	}, hashFn, pool)
+	s.setWindow(50 * time.Millisecond)
+
+	s.touch(path, settleCreated)
+	s.closed(path)
+	select {
+	case <-hashStarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("file never reached the hash stage")
+	}
+
+	// More data arrives while the first hash is running
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte(" and part two"))
+	_ = f.Close()
+	s.touch(path, settleModified)
+	close(release)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(emitted)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(emitted) != 1 || emitted[0] != "fresh" {
+		t.Errorf("emitted hashes = %v, want [fresh]", emitted)
+	}
+}
@@ -0,0 +1,238 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/fsutil"
+)
+
+// volumeCheckInterval is how often every watch path is checked for availability.
+const volumeCheckInterval = 10 * time.Second
+
+// volumeCheckTimeout bounds a check: stat on a hard NFS mount whose server is gone
+// blocks until the server returns.
+const volumeCheckTimeout = 5 * time.Second
+
+// volumeRecheck is how long a check result is reused, so a burst of deletions
+// triggers one check rather than one per file.
+const volumeRecheck = time.Second
+
+// volumeProbe is the state of the filesystem holding a watch path.
+type volumeProbe struct {
+	dev        uint64
+	mountpoint bool // the path is the root of its filesystem
+	err        error
+}
+
+// probeVolume stats and reads root. A USB disk that dropped or a FUSE/NFS mount
+// whose server is gone fails here with EIO, ENOTCONN or ESTALE.
+func probeVolume(root string) volumeProbe {
+	info, err := os.Stat(root)
+	if err != nil {
+		return volumeProbe{err: err}
+	}
+	if !info.IsDir() {
+		return volumeProbe{err: fmt.Errorf("%s is not a directory", root)}
+	}
+	f, err := os.Open(root)
+	if err != nil {
+		return volumeProbe{err: err}
+	}
+	_, err = f.Readdirnames(1)
+	f.Close()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return volumeProbe{err: err}
+	}
+
+	p := volumeProbe{mountpoint: true}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		p.dev = uint64(st.Dev)
+	}
+	if parent := filepath.Dir(root); parent != root {
+		if pinfo, err := os.Stat(parent); err == nil {
+			if pst, ok := pinfo.Sys().(*syscall.Stat_t); ok {
+				p.mountpoint = uint64(pst.Dev) != p.dev
+			}
+		}
+	}
+	return p
+}
+
+// volumeState is what is known about the filesystem of one watch path.
+type volumeState struct {
+	available bool
+	dev       uint64 // device the path was on when last available; 0 until first seen
+	reason    string
+	checked   time.Time
+	checking  bool // a probe is running, possibly stuck
+}
+
+// volumeMonitor tells whether the filesystem holding each watch path is there.
+// A path is unavailable if it cannot be stat'ed or read, or if it moved to another
+// device without being a mount point: its filesystem was unmounted and the path
+// now shows the empty directory underneath.
+//
+// The device of each path is recorded in a store file, so a path found on
+// another device after a restart is caught the same way.
+type volumeMonitor struct {
+	mu     sync.Mutex
+	states map[string]*volumeState
+	known  map[string]uint64 // path → device it was last available on
+
+	storeMu   sync.Mutex // serializes writes of the store file
+	storePath string
+
+	probe    func(root string) volumeProbe
+	onChange func(root string, available bool, dev uint64, reason string)
+}
+
+func newVolumeMonitor(onChange func(root string, available bool, dev uint64, reason string)) *volumeMonitor {
+	return &volumeMonitor{
+		states:   make(map[string]*volumeState),
+		known:    make(map[string]uint64),
+		probe:    probeVolume,
+		onChange: onChange,
+	}
+}
+
+// setStore loads the devices recorded at path and records them there from now
+// on. A missing file records none; an unreadable one is replaced.
+func (m *volumeMonitor) setStore(path string) error {
+	known := make(map[string]uint64)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &known); err != nil {
+			known = make(map[string]uint64)
+			slog.Warn("Discarding unreadable volume state", "path", path, "error", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.known = known
+	m.storePath = path
+	return nil
+}
+
+// save writes the recorded devices to the store file, replacing it atomically.
+func (m *volumeMonitor) save() {
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+
+	m.mu.Lock()
+	path := m.storePath
+	data, err := json.Marshal(m.known)
+	m.mu.Unlock()
+	if path == "" || err != nil {
+		return
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data); err != nil {
+		slog.Warn("Failed to save volume state", "path", path, "error", err)
+	}
+}
+
+// check probes root unless a recent result is known, and returns whether it is
+// available. Watch paths are presumed available until a probe says otherwise.
+func (m *volumeMonitor) check(root string) bool {
+	m.mu.Lock()
+	st, ok := m.states[root]
+	if !ok {
+		st = &volumeState{available: true, dev: m.known[root]}
+		m.states[root] = st
+	}
+	if st.checking || time.Since(st.checked) < volumeRecheck {
+		available := st.available
+		m.mu.Unlock()
+		return available
+	}
+	st.checking = true
+	m.mu.Unlock()
+
+	result := make(chan volumeProbe, 1)
+	go func() {
+		p := m.probe(root)
+		m.mu.Lock()
+		st.checking = false
+		m.mu.Unlock()
+		result <- p
+	}()
+
+	var p volumeProbe
+	select {
+	case p = <-result:
+	case <-time.After(volumeCheckTimeout):
+		p.err = fmt.Errorf("no response after %v", volumeCheckTimeout)
+	}
+	return m.apply(root, st, p)
+}
+
+// apply records the outcome of a probe and reports a change of availability.
+// A path that moved to a new mount point is reported available again even if it
+// never was unavailable, since what it holds changed. The first probe of a path
+// is checked against the device recorded by a previous run, if any.
+func (m *volumeMonitor) apply(root string, st *volumeState, p volumeProbe) bool {
+	m.mu.Lock()
+	if m.states[root] != st {
+		// Forgotten while probing
+		m.mu.Unlock()
+		return true
+	}
+	was := st.available
+	remounted := false
+	st.checked = time.Now()
+	switch {
+	case p.err != nil:
+		st.available, st.reason = false, p.err.Error()
+	case st.dev == 0 || p.dev == st.dev:
+		st.available, st.reason, st.dev = true, "", p.dev
+	case p.mountpoint:
+		st.available, st.reason, st.dev = true, "", p.dev
+		remounted = true
+	default:
+		st.available, st.reason = false, "not mounted"
+	}
+	available, dev, reason := st.available, st.dev, st.reason
+	record := available && m.storePath != "" && m.known[root] != dev
+	if record {
+		m.known[root] = dev
+	}
+	m.mu.Unlock()
+
+	if record {
+		m.save()
+	}
+	if available != was || remounted {
+		m.onChange(root, available, dev, reason)
+	}
+	return available
+}
+
+// forget drops the state of a watch path that is no longer watched.
+func (m *volumeMonitor) forget(root string) {
+	m.mu.Lock()
+	delete(m.states, root)
+	_, recorded := m.known[root]
+	delete(m.known, root)
+	m.mu.Unlock()
+
+	if recorded {
+		m.save()
+	}
+}
@@ -0,0 +1,160 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// volumeChange is one call of the volumeMonitor onChange callback.
+type volumeChange struct {
+	available bool
+	dev       uint64
+}
+
+// recheck makes the next check of root probe again.
+func recheck(m *volumeMonitor, root string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st, ok := m.states[root]; ok {
+		st.checked = time.Time{}
+	}
+}
+
+func TestVolumeMonitor_DeviceChanges(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "volumes.json")
+	var changes []volumeChange
+	m := newVolumeMonitor(func(root string, available bool, dev uint64, reason string) {
+		changes = append(changes, volumeChange{available, dev})
+	})
+	if err := m.setStore(store); err != nil {
+		t.Fatal(err)
+	}
+	probe := volumeProbe{dev: 10, mountpoint: true}
+	m.probe = func(string) volumeProbe { return probe }
+
+	steps := []struct {
+		name  string
+		probe volumeProbe
+		want  bool
+	}{
+		{"mounted", volumeProbe{dev: 10, mountpoint: true}, true},
+		{"unmounted: empty directory on the parent filesystem", volumeProbe{dev: 1}, false},
+		{"still unmounted", volumeProbe{dev: 1}, false},
+		{"mounted again", volumeProbe{dev: 10, mountpoint: true}, true},
+		{"disk dropped", volumeProbe{err: errors.New("input/output error")}, false},
+		{"another disk mounted", volumeProbe{dev: 11, mountpoint: true}, true},
+	}
+	for _, step := range steps {
+		probe = step.probe
+		recheck(m, "/mnt/nas")
+		if got := m.check("/mnt/nas"); got != step.want {
+			t.Errorf("%s: check = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	want := []volumeChange{{false, 10}, {true, 10}, {false, 10}, {true, 11}}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %v, want %v", i, changes[i], want[i])
+		}
+	}
+
+	// Restarted while the share is unmounted: the first probe is checked against
+	// the device recorded by the previous run
+	changes = nil
+	m = newVolumeMonitor(func(root string, available bool, dev uint64, reason string) {
+		changes = append(changes, volumeChange{available, dev})
+	})
+	if err := m.setStore(store); err != nil {
+		t.Fatal(err)
+	}
+	probe = volumeProbe{dev: 1}
+	m.probe = func(string) volumeProbe { return probe }
+	if m.check("/mnt/nas") {
+		t.Error("unmounted at startup: check = true, want false")
+	}
+	probe = volumeProbe{dev: 11, mountpoint: true}
+	recheck(m, "/mnt/nas")
+	if !m.check("/mnt/nas") {
+		t.Error("mounted after startup: check = false, want true")
+	}
+	want = []volumeChange{{false, 11}, {true, 11}}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("changes after restart = %v, want %v", changes, want)
+	}
+
+	// Without a recorded device the first probe is the baseline
+	m = newVolumeMonitor(func(string, bool, uint64, string) {})
+	m.probe = func(string) volumeProbe { return volumeProbe{dev: 1} }
+	if !m.check("/mnt/nas") {
+		t.Error("first probe without a store: check = false, want true")
+	}
+}
+
+func TestFileWatcher_UnavailableVolumeSuppressesDeletes(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "Film (2024)")
+	if err := os.Mkdir(release, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(release, "film.mkv"))
+	writeFile(t, filepath.Join(root, "other.mkv"))
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w, rec := startWatcher(t, b, root)
+	rescanned := make(chan string, 1)
+	w.OnVolumeAvailable = func(path string) { rescanned <- path }
+
+	// The share is unmounted: what is left looks like a wiped library
+	w.volumes.mu.Lock()
+	w.volumes.probe = func(string) volumeProbe { return volumeProbe{dev: 1} }
+	w.volumes.mu.Unlock()
+	recheck(w.volumes, root)
+	if err := os.RemoveAll(release); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "other.mkv")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForEvents(t, rec, "volume.unavailable", 1)
+	time.Sleep(300 * time.Millisecond)
+	if n := len(rec.EventsOfType("file.deleted")); n != 0 {
+		t.Errorf("got %d file.deleted events while the volume was unavailable, want none", n)
+	}
+	if w.Available(filepath.Join(root, "other.mkv")) {
+		t.Error("Available() = true for a path on an unavailable volume")
+	}
+
+	// Mounted again: watched afresh and handed over for a rescan
+	w.volumes.mu.Lock()
+	w.volumes.probe = probeVolume
+	w.volumes.mu.Unlock()
+	recheck(w.volumes, root)
+	if !w.Available(root) {
+		t.Fatal("Available() = false once the volume is back")
+	}
+	available := waitForEvents(t, rec, "volume.available", 1)
+	if p := available[0].Data.(models.VolumeData).Path; p != root {
+		t.Errorf("volume.available path = %s, want %s", p, root)
+	}
+	select {
+	case p := <-rescanned:
+		if p != root {
+			t.Errorf("rescanned %s, want %s", p, root)
+		}
+	case <-time.After(time.Second):
+		t.Error("OnVolumeAvailable not called")
+	}
+}
@@ -4,89 +4,310 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/voclinx/scanarr-watcher/internal/filter"
 	"github.com/voclinx/scanarr-watcher/internal/hardlink"
+	"github.com/voclinx/scanarr-watcher/internal/hash"
 	"github.com/voclinx/scanarr-watcher/internal/models"
-	"github.com/voclinx/scanarr-watcher/internal/websocket"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
 )
 
-// FileWatcher watches directories for filesystem changes using fsnotify.
+// movePairTimeout bounds how long the first half of a cookie-tagged rename waits for
+// its second half. The kernel queues both back to back, so this only delays the
+// file.deleted of a file moved out of the watched tree.
+const movePairTimeout = 500 * time.Millisecond
+
+// overflowRescanDelay gathers the overflows of an event storm into one rescan per
+// watch path, started once the storm has been quiet that long.
+const overflowRescanDelay = 2 * time.Second
+
+// overflowRescanMaxDelay bounds how long a storm that never quiets down postpones
+// the rescan, counted from its first overflow.
+const overflowRescanMaxDelay = 30 * time.Second
+
+// legacyMovePairTimeout is the window in which the fsnotify backend pairs a Rename
+// with the next Create, since it has no cookie to go by.
+const legacyMovePairTimeout = 100 * time.Millisecond
+
+// watchMode selects how the directories of a watch path are watched.
+type watchMode string
+
+const (
+	// modeAuto polls directories on network filesystems and uses kernel
+	// notifications everywhere else.
+	modeAuto watchMode = "auto"
+	// modeNative always uses kernel notifications (fanotify, inotify).
+	modeNative watchMode = "native"
+	// modePoll always polls, e.g. for FUSE mounts fed by other hosts.
+	modePoll watchMode = "poll"
+)
+
+// FileWatcher watches directories for filesystem changes.
+// It uses the native inotify backend when available, fsnotify otherwise, and
+// polls the watch paths configured (or detected) as remote.
 type FileWatcher struct {
-	fsWatcher *fsnotify.Watcher
-	wsClient  *websocket.Client
-	paths     []string
+	backend   backend
+	publisher publisher.EventPublisher
+
+	// registry knows the watch paths and the directories watched for them.
+	registry *watchRegistry
+
+	// native and poll are the backends behind backend when built by New;
+	// modes selects between them per watch path (modeAuto if unset).
+	native backend
+	poll   *pollBackend
+	modes  map[string]watchMode
 
 	// Debounce: track recently seen events to avoid duplicates
 	recentEvents map[string]time.Time
 	mu           sync.Mutex
 	debounceDur  time.Duration
+
+	// pendingMoves holds the IN_MOVED_FROM half of renames, keyed by move cookie
+	// (0 for the fsnotify backend), until the matching half arrives or times out.
+	pendingMoves map[uint32]*pendingMove
+
+	// index knows the media files under the watched roots, for directory events.
+	index *mediaIndex
+
+	// settle holds back created/modified events until files are fully written
+	// and hashed; hashes are computed on hashPool.
+	settle   *settler
+	hashPool *workPool
+
+	// overflowed collects the watch paths that lost events until they are
+	// rescanned by overflowTimer, at overflowDeadline at the latest. overflowGen
+	// counts the timers: one that fired while it was being replaced finds a newer
+	// generation and leaves the rescan to its successor.
+	overflowed       map[string]bool
+	overflowTimer    *time.Timer
+	overflowGen      uint64
+	overflowDelay    time.Duration
+	overflowMaxDelay time.Duration
+	overflowDeadline time.Time
+
+	// OnOverflow is called with the watch paths that lost events, once the
+	// watcher re-synced its own state; the caller rescans them for the API.
+	OnOverflow func(paths []string)
+
+	// volumes tracks whether the filesystem of each watch path is mounted and
+	// readable; deletions are not reported while it is not.
+	volumes *volumeMonitor
+
+	// OnVolumeAvailable is called when the filesystem of a watch path came back
+	// (or was mounted over it), once it is watched again; the caller rescans it.
+	OnVolumeAvailable func(path string)
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// pendingMove is a rename source waiting for its destination.
+type pendingMove struct {
+	path  string
+	isDir bool
+	timer *time.Timer
 }
 
 // New creates a new FileWatcher.
-func New(wsClient *websocket.Client, paths []string) (*FileWatcher, error) {
-	fsw, err := fsnotify.NewWatcher()
+func New(pub publisher.EventPublisher, paths []string) (*FileWatcher, error) {
+	native, err := newBackend()
 	if err != nil {
 		return nil, err
 	}
+	poll := newPollBackend(defaultPollInterval)
+	r := newRoutedBackend(native, poll)
+	w := newWithBackend(pub, paths, r)
+	w.native, w.poll = native, poll
+	r.route = w.backendsFor
+	return w, nil
+}
+
+func newWithBackend(pub publisher.EventPublisher, paths []string, b backend) *FileWatcher {
+	w := &FileWatcher{
+		backend:          b,
+		publisher:        pub,
+		registry:         newWatchRegistry(),
+		recentEvents:     make(map[string]time.Time),
+		debounceDur:      500 * time.Millisecond,
+		pendingMoves:     make(map[uint32]*pendingMove),
+		index:            newMediaIndex(),
+		modes:            make(map[string]watchMode),
+		overflowed:       make(map[string]bool),
+		overflowDelay:    overflowRescanDelay,
+		overflowMaxDelay: overflowRescanMaxDelay,
+		done:             make(chan struct{}),
+	}
+	w.volumes = newVolumeMonitor(w.handleVolumeChange)
+	for _, path := range paths {
+		w.registry.addRoot(filepath.Clean(path))
+	}
+	w.hashPool = newWorkPool(hashWorkers, hashQueue)
+	w.settle = newSettler(w.emitSettled, hash.Calculate, w.hashPool)
+	return w
+}
 
-	return &FileWatcher{
-		fsWatcher:    fsw,
-		wsClient:     wsClient,
-		paths:        paths,
-		recentEvents: make(map[string]time.Time),
-		debounceDur:  500 * time.Millisecond,
-	}, nil
+// SetHashCache makes settled files be hashed through c. Call before Start.
+func (w *FileWatcher) SetHashCache(c *hash.Cache) {
+	w.settle.hash = c.Calculate
+}
+
+// SetVolumeStore records the device of each watch path in the file at path, and
+// checks the first probe of each path against what a previous run recorded there.
+// Call before Start.
+func (w *FileWatcher) SetVolumeStore(path string) error {
+	return w.volumes.setStore(path)
 }
 
 // Start begins watching all configured paths.
 func (w *FileWatcher) Start() error {
-	for _, path := range w.paths {
-		if err := w.addRecursive(path); err != nil {
+	paths := w.registry.rootList()
+	for _, path := range paths {
+		if !w.volumes.check(path) {
+			slog.Warn("Watch path unavailable, watching it until it comes back", "path", path)
+		}
+		if err := w.addRecursive(path, false); err != nil {
 			slog.Warn("Failed to watch path", "path", path, "error", err)
 		}
 	}
 
 	go w.eventLoop()
 	go w.cleanupLoop()
+	go w.volumeLoop()
 
-	slog.Info("FileWatcher started", "paths", w.paths)
+	slog.Info("FileWatcher started", "paths", paths, "backend", w.backend.Name())
 	return nil
 }
 
-// AddPath adds a new path to watch.
+// AddPath adds a new path to watch. A path nested in (or holding) another watch
+// path shares its watches: every directory is watched once.
 func (w *FileWatcher) AddPath(path string) error {
-	w.paths = append(w.paths, path)
-	return w.addRecursive(path)
+	path = filepath.Clean(path)
+	if !w.registry.addRoot(path) {
+		return nil
+	}
+	if !w.volumes.check(path) {
+		slog.Warn("Watch path unavailable, watching it until it comes back", "path", path)
+	}
+	return w.addRecursive(path, false)
 }
 
-// RemovePath removes a path from watching.
+// RemovePath stops watching a path and every directory below it, except those
+// still under another watch path.
 func (w *FileWatcher) RemovePath(path string) error {
-	_ = w.fsWatcher.Remove(path)
-	newPaths := make([]string, 0, len(w.paths))
-	for _, p := range w.paths {
-		if p != path {
-			newPaths = append(newPaths, p)
+	path = filepath.Clean(path)
+	orphans, ok := w.registry.removeRoot(path)
+	if !ok {
+		return nil
+	}
+	w.volumes.forget(path)
+	for _, dir := range orphans {
+		if err := w.backend.Remove(dir); err != nil {
+			slog.Debug("Failed to remove directory from watcher", "path", dir, "error", err)
 		}
+		w.index.forgetDir(dir)
+		w.settle.cancelDir(dir)
 	}
-	w.paths = newPaths
 	return nil
 }
 
+// SetSettleWindow sets how long a file must stay unwritten before file.created or
+// file.modified is sent. d <= 0 restores the default.
+func (w *FileWatcher) SetSettleWindow(d time.Duration) {
+	w.settle.setWindow(d)
+}
+
+// SetPollInterval sets how often polled directories are listed. d <= 0 restores the default.
+func (w *FileWatcher) SetPollInterval(d time.Duration) {
+	if w.poll != nil {
+		w.poll.setInterval(d)
+	}
+}
+
+// SetPathModes sets the watch mode of each watch path: "auto" (the default),
+// "native" or "poll". Watch paths whose mode changed are watched again.
+func (w *FileWatcher) SetPathModes(modes map[string]string) {
+	next := make(map[string]watchMode, len(modes))
+	for path, m := range modes {
+		switch mode := watchMode(m); mode {
+		case modeAuto, modeNative, modePoll:
+			next[filepath.Clean(path)] = mode
+		default:
+			slog.Warn("Unknown watch mode, using auto", "path", path, "mode", m)
+		}
+	}
+
+	w.mu.Lock()
+	prev := w.modes
+	w.modes = next
+	w.mu.Unlock()
+
+	for _, root := range w.registry.rootList() {
+		if modeOf(prev, root) == modeOf(next, root) {
+			continue
+		}
+		slog.Info("Watch mode changed", "path", root, "mode", modeOf(next, root))
+		w.removeTree(root)
+		if err := w.addRecursive(root, false); err != nil {
+			slog.Warn("Failed to watch path", "path", root, "error", err)
+		}
+	}
+}
+
+// modeOf returns the mode of the closest watch path holding dir in modes.
+func modeOf(modes map[string]watchMode, dir string) watchMode {
+	mode, best := modeAuto, -1
+	for path, m := range modes {
+		if len(path) > best && within(dir, path) {
+			mode, best = m, len(path)
+		}
+	}
+	return mode
+}
+
+// backendsFor picks the backend watching dir from the mode of its watch path.
+func (w *FileWatcher) backendsFor(dir string) []backend {
+	w.mu.Lock()
+	mode := modeOf(w.modes, dir)
+	w.mu.Unlock()
+
+	switch mode {
+	case modePoll:
+		return []backend{w.poll}
+	case modeNative:
+		return []backend{w.native}
+	}
+	if fsType := networkFS(dir); fsType != "" {
+		slog.Debug("Polling directory on network filesystem", "path", dir, "fs_type", fsType)
+		return []backend{w.poll}
+	}
+	return []backend{w.native}
+}
+
 // GetWatchedPaths returns the currently watched paths.
 func (w *FileWatcher) GetWatchedPaths() []string {
-	return w.paths
+	return w.registry.rootList()
 }
 
 // Close stops the watcher.
 func (w *FileWatcher) Close() error {
-	return w.fsWatcher.Close()
+	w.closeOnce.Do(func() { close(w.done) })
+	w.mu.Lock()
+	if w.overflowTimer != nil {
+		w.overflowTimer.Stop()
+	}
+	w.mu.Unlock()
+	w.hashPool.stop()
+	return w.backend.Close()
 }
 
-func (w *FileWatcher) addRecursive(root string) error {
+// addRecursive watches root and every directory below it, and indexes the media
+// files found. With announce, media files the index did not know yet are reported
+// as created: they appeared before the watch on their directory was in place.
+func (w *FileWatcher) addRecursive(root string, announce bool) error {
 	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
@@ -95,27 +316,39 @@ func (w *FileWatcher) addRecursive(root string) error {
 			if filter.IsIgnoredDir(path) {
 				return filepath.SkipDir
 			}
-			if err := w.fsWatcher.Add(path); err != nil {
+			if err := w.backend.Add(path); err != nil {
 				slog.Warn("Failed to add directory to watcher", "path", path, "error", err)
+			} else {
+				w.registry.addDir(path)
 			}
+			w.index.addDir(path)
+			return nil
+		}
+		if filter.ShouldProcess(path) && w.index.add(path) && announce {
+			w.handleCreate(path)
 		}
 		return nil
 	})
 }
 
-func (w *FileWatcher) eventLoop() {
-	// Track renames: fsnotify sends Rename then Create for a move
-	var lastRenamePath string
+// removeTree drops the watches of dir and every directory below it.
+func (w *FileWatcher) removeTree(dir string) {
+	for _, watched := range w.registry.removeTree(dir) {
+		_ = w.backend.Remove(watched)
+	}
+}
 
+func (w *FileWatcher) eventLoop() {
+	events, errs := w.backend.Events(), w.backend.Errors()
 	for {
 		select {
-		case event, ok := <-w.fsWatcher.Events:
+		case ev, ok := <-events:
 			if !ok {
 				return
 			}
-			w.handleEvent(event, &lastRenamePath)
+			w.handleEvent(ev)
 
-		case err, ok := <-w.fsWatcher.Errors:
+		case err, ok := <-errs:
 			if !ok {
 				return
 			}
@@ -124,73 +357,366 @@ func (w *FileWatcher) eventLoop() {
 	}
 }
 
-func (w *FileWatcher) handleEvent(event fsnotify.Event, lastRenamePath *string) {
-	path := event.Name
+func (w *FileWatcher) handleEvent(ev event) {
+	path := ev.path
 
-	// Check if it's a directory event
-	info, statErr := os.Stat(path)
-	isDir := statErr == nil && info.IsDir()
+	switch ev.op {
+	case opOverflow:
+		w.handleOverflow(ev.source)
+		return
+	case opUnwatched:
+		// Still there means unmounted rather than deleted: its files are not gone.
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			w.handleDirRemoved(path)
+		} else {
+			w.Available(path)
+		}
+		return
+	case opMovedFrom:
+		w.holdMove(ev)
+		return
+	case opMovedTo:
+		if from, ok := w.takeMove(ev.cookie); ok {
+			w.handleMove(from, ev)
+		} else {
+			// Moved in from outside the watched tree
+			w.handleMovedIn(ev)
+		}
+		return
+	}
 
-	// If a new directory is created, add it to the watcher
-	if isDir && event.Has(fsnotify.Create) {
-		if !filter.IsIgnoredDir(path) {
-			_ = w.addRecursive(path)
+	// fsnotify reports a rename as Rename followed by Create, without a cookie.
+	// Native backends never park a move under cookie 0, so this only pairs fsnotify renames.
+	if ev.op == opCreate && ev.cookie == 0 {
+		if from, ok := w.takeMove(0); ok {
+			w.handleMove(from, ev)
+			return
+		}
+	}
+
+	// fsnotify cannot stat a removed entry, so a removed directory is recognised by the index
+	if ev.isDir || (ev.op == opRemove && w.index.hasDir(path)) {
+		switch {
+		case ev.op == opCreate && !filter.IsIgnoredDir(path):
+			// If a new directory is created, add it to the watcher
+			_ = w.addRecursive(path, true)
+		case ev.op == opRemove:
+			w.handleDirRemoved(path)
 		}
 		return
 	}
 
 	// Only process media files
-	if !isDir && !filter.ShouldProcess(path) {
+	if !filter.ShouldProcess(path) {
+		return
+	}
+
+	// Writes only re-arm the settle window; they need no debouncing.
+	switch ev.op {
+	case opWrite:
+		w.handleModified(path)
+		return
+	case opCloseWrite:
+		w.settle.closed(path)
 		return
 	}
 
 	// Debounce: skip if we've seen this exact event recently
-	eventKey := event.Op.String() + ":" + path
+	eventKey := strconv.Itoa(int(ev.op)) + ":" + path
 	if w.isDuplicate(eventKey) {
 		return
 	}
 
-	switch {
-	case event.Has(fsnotify.Create):
-		w.mu.Lock()
-		rename := *lastRenamePath
-		if rename != "" {
-			// This is the second part of a rename (old Rename + new Create)
-			*lastRenamePath = ""
-			w.mu.Unlock()
-			w.handleRename(rename, path)
+	switch ev.op {
+	case opCreate:
+		if w.index.has(path) {
+			// Already reported by addRecursive when its directory appeared
 			return
 		}
-		w.mu.Unlock()
 		w.handleCreate(path)
-
-	case event.Has(fsnotify.Remove):
+	case opRemove:
 		w.handleDelete(path)
+	}
+}
+
+// handleOverflow schedules a rescan of the watch paths whose directories the
+// overflowing backend watches.
+func (w *FileWatcher) handleOverflow(source backend) {
+	roots := w.registry.rootList()
+	name := w.backend.Name()
+	if source != nil {
+		roots = w.registry.rootsHolding(source.WatchList())
+		name = source.Name()
+	}
+	slog.Warn("Filesystem event queue overflowed, some changes were missed", "backend", name, "paths", roots)
+	if len(roots) == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, root := range roots {
+		w.overflowed[root] = true
+	}
+	delay := w.overflowDelay
+	if w.overflowTimer == nil {
+		w.overflowDeadline = time.Now().Add(w.overflowMaxDelay)
+	} else {
+		// Wait for the storm to quiet down, but not past the deadline
+		w.overflowTimer.Stop()
+		if left := time.Until(w.overflowDeadline); left < delay {
+			delay = left
+		}
+	}
+	w.overflowGen++
+	gen := w.overflowGen
+	w.overflowTimer = time.AfterFunc(delay, func() { w.rescanOverflowed(gen) })
+}
+
+// rescanOverflowed re-syncs the watches and index of the watch paths that lost
+// events, then hands them to OnOverflow. No-op unless gen is the current timer's.
+func (w *FileWatcher) rescanOverflowed(gen uint64) {
+	w.mu.Lock()
+	if gen != w.overflowGen {
+		w.mu.Unlock()
+		return
+	}
+	overflowed := w.overflowed
+	w.overflowed = make(map[string]bool)
+	w.overflowTimer = nil
+	w.mu.Unlock()
+
+	// Skip watch paths removed in the meantime
+	current := make(map[string]bool)
+	for _, root := range w.registry.rootList() {
+		if overflowed[root] {
+			current[root] = true
+		}
+	}
+	roots := outermost(current)
+	if len(roots) == 0 {
+		return
+	}
+	for _, root := range roots {
+		w.resync(root)
+	}
+	slog.Info("Rescanning paths after event overflow", "paths", roots)
+	if w.OnOverflow != nil {
+		w.OnOverflow(roots)
+	}
+}
+
+// resync rebuilds what the watcher knows under root from the disk, silently: the
+// rescan that follows reports the differences to the API. Watches on directories
+// that vanished are dropped, and directories created meanwhile get one.
+func (w *FileWatcher) resync(root string) {
+	for _, dir := range w.registry.dirsUnder(root) {
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			w.removeTree(dir)
+		}
+	}
+	w.index.removeDir(root)
+	if err := w.addRecursive(root, false); err != nil {
+		slog.Warn("Failed to re-sync watch path", "path", root, "error", err)
+	}
+}
+
+// Available reports whether the filesystems of the watch paths holding path are
+// mounted and readable. Paths outside every watch path are presumed available.
+func (w *FileWatcher) Available(path string) bool {
+	available := true
+	for _, root := range w.registry.rootsOf(filepath.Clean(path)) {
+		if !w.volumes.check(root) {
+			available = false
+		}
+	}
+	return available
+}
+
+// handleVolumeChange reports a watch path whose filesystem went away or came back.
+// On return the path is watched and indexed again from scratch: the watches of the
+// unmounted filesystem are gone, and the files may not be the same.
+func (w *FileWatcher) handleVolumeChange(root string, available bool, dev uint64, reason string) {
+	if !available {
+		slog.Warn("Volume unavailable, deletions suppressed", "path", root, "reason", reason)
+		w.publisher.SendEvent("volume.unavailable", models.VolumeData{
+			Path:   root,
+			Reason: reason,
+		})
+		return
+	}
 
-	case event.Has(fsnotify.Rename):
+	slog.Info("Volume available", "path", root, "device_id", dev)
+	w.removeTree(root)
+	w.resync(root)
+	w.publisher.SendEvent("volume.available", models.VolumeData{
+		Path:     root,
+		DeviceID: dev,
+	})
+	if w.OnVolumeAvailable != nil {
+		w.OnVolumeAvailable(root)
+	}
+}
+
+// holdMove parks the source of a rename until its destination arrives.
+// If none does, the entry was moved out of the watched tree.
+func (w *FileWatcher) holdMove(ev event) {
+	timeout := movePairTimeout
+	if ev.cookie == 0 {
+		timeout = legacyMovePairTimeout
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if prev, ok := w.pendingMoves[ev.cookie]; ok {
+		// Only possible without cookies: the previous rename never got its Create.
+		prev.timer.Stop()
+		delete(w.pendingMoves, ev.cookie)
+		go w.handleMovedOut(prev)
+	}
+
+	pm := &pendingMove{path: ev.path, isDir: ev.isDir}
+	pm.timer = time.AfterFunc(timeout, func() {
 		w.mu.Lock()
-		*lastRenamePath = path
+		if w.pendingMoves[ev.cookie] != pm {
+			w.mu.Unlock()
+			return
+		}
+		delete(w.pendingMoves, ev.cookie)
 		w.mu.Unlock()
-		// Wait briefly for the Create event that follows a rename
-		go func(oldPath string) {
-			time.Sleep(100 * time.Millisecond)
-			w.mu.Lock()
-			if *lastRenamePath == oldPath {
-				// No Create followed — treat as delete
-				*lastRenamePath = ""
-				w.mu.Unlock()
-				w.handleDelete(oldPath)
-			} else {
-				w.mu.Unlock()
-			}
-		}(path)
+		w.handleMovedOut(pm)
+	})
+	w.pendingMoves[ev.cookie] = pm
+}
 
-	case event.Has(fsnotify.Write):
-		w.handleModified(path)
+// takeMove returns and forgets the pending rename source with the given cookie.
+func (w *FileWatcher) takeMove(cookie uint32) (*pendingMove, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pm, ok := w.pendingMoves[cookie]
+	if !ok {
+		return nil, false
+	}
+	pm.timer.Stop()
+	delete(w.pendingMoves, cookie)
+	return pm, true
+}
+
+// handleMove handles a rename whose source and destination are both watched.
+func (w *FileWatcher) handleMove(from *pendingMove, to event) {
+	if to.isDir || from.isDir || w.index.hasDir(from.path) {
+		w.handleDirMove(from.path, to.path)
+		return
+	}
+
+	fromMedia, toMedia := filter.ShouldProcess(from.path), filter.ShouldProcess(to.path)
+	switch {
+	case fromMedia && toMedia:
+		w.handleRename(from.path, to.path)
+	case toMedia:
+		// e.g. a download renamed from .part to its final name
+		w.handleCreate(to.path)
+	case fromMedia:
+		w.handleDelete(from.path)
+	}
+}
+
+// handleDirMove propagates a directory rename to the media files it contains.
+func (w *FileWatcher) handleDirMove(oldDir, newDir string) {
+	// Keep the watches of the moved tree, now under their new paths.
+	if err := w.backend.Rename(oldDir, newDir); err != nil {
+		w.removeTree(oldDir)
+	} else {
+		w.registry.renameTree(oldDir, newDir)
+	}
+
+	moved := w.index.moveDir(oldDir, newDir)
+	if filter.IsIgnoredDir(newDir) {
+		// Moved into an ignored directory such as a recycle bin: gone as far as we care.
+		w.removeTree(newDir)
+		w.index.removeDir(newDir)
+		for _, f := range moved {
+			w.handleDelete(f.oldPath)
+		}
+		return
 	}
+
+	slog.Info("Directory renamed", "old_path", oldDir, "new_path", newDir, "files", len(moved))
+	for _, f := range moved {
+		w.handleRename(f.oldPath, f.newPath)
+	}
+	// Watch anything the index did not know about (e.g. ignored before the move).
+	_ = w.addRecursive(newDir, true)
 }
 
+// handleDirRemoved reports as deleted every media file still known under a removed
+// directory: those whose own deletion event was lost while the tree was torn down.
+func (w *FileWatcher) handleDirRemoved(dir string) {
+	if !w.Available(dir) {
+		// Gone with its volume: keep the index, it is rebuilt when the volume returns.
+		w.removeTree(dir)
+		return
+	}
+	w.removeTree(dir)
+	files := w.index.removeDir(dir)
+	if len(files) == 0 {
+		return
+	}
+	slog.Info("Directory removed", "path", dir, "files", len(files))
+	for _, f := range files {
+		w.handleDelete(f)
+	}
+}
+
+// handleMovedIn handles an entry moved into the watched tree from elsewhere.
+func (w *FileWatcher) handleMovedIn(ev event) {
+	if ev.isDir {
+		if !filter.IsIgnoredDir(ev.path) {
+			_ = w.addRecursive(ev.path, true)
+		}
+		return
+	}
+	if filter.ShouldProcess(ev.path) {
+		w.handleCreate(ev.path)
+	}
+}
+
+// handleMovedOut handles an entry moved out of the watched tree.
+func (w *FileWatcher) handleMovedOut(pm *pendingMove) {
+	if pm.isDir || w.index.hasDir(pm.path) {
+		w.removeTree(pm.path)
+		w.index.removeDir(pm.path)
+		return
+	}
+	if filter.ShouldProcess(pm.path) {
+		w.handleDelete(pm.path)
+	}
+}
+
+// handleCreate starts tracking a new file; file.created is sent once it settles.
 func (w *FileWatcher) handleCreate(path string) {
+	w.index.add(path)
+	w.settle.touch(path, settleCreated)
+}
+
+// handleModified re-arms the settle window of a file being written.
+func (w *FileWatcher) handleModified(path string) {
+	w.index.add(path)
+	w.settle.touch(path, settleModified)
+}
+
+// emitSettled sends the event of a file that finished settling.
+func (w *FileWatcher) emitSettled(path string, kind settleKind, partialHash string) {
+	if kind == settleCreated {
+		w.emitCreated(path, partialHash)
+	} else {
+		w.emitModified(path, partialHash)
+	}
+}
+
+func (w *FileWatcher) emitCreated(path, partialHash string) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return
@@ -202,7 +728,7 @@ func (w *FileWatcher) handleCreate(path string) {
 	}
 
 	slog.Info("File created", "path", path)
-	w.wsClient.SendEvent("file.created", models.FileCreatedData{
+	w.publisher.SendEvent("file.created", models.FileCreatedData{
 		Path:          path,
 		Name:          filepath.Base(path),
 		SizeBytes:     info.Size(),
@@ -210,12 +736,22 @@ func (w *FileWatcher) handleCreate(path string) {
 		Inode:         fileInfo.Inode,
 		DeviceID:      fileInfo.DeviceID,
 		IsDir:         false,
+		PartialHash:   partialHash,
 	})
 }
 
 func (w *FileWatcher) handleDelete(path string) {
+	if !w.Available(path) {
+		slog.Debug("Volume unavailable, deletion not reported", "path", path)
+		return
+	}
+	w.index.remove(path)
+	if kind, ok := w.settle.cancel(path); ok && kind == settleCreated {
+		// Never announced: the API does not know the file
+		return
+	}
 	slog.Info("File deleted", "path", path)
-	w.wsClient.SendEvent("file.deleted", models.FileDeletedData{
+	w.publisher.SendEvent("file.deleted", models.FileDeletedData{
 		Path: path,
 		Name: filepath.Base(path),
 	})
@@ -228,6 +764,12 @@ func (w *FileWatcher) handleRename(oldPath, newPath string) {
 		w.handleDelete(oldPath)
 		return
 	}
+	w.index.remove(oldPath)
+	w.index.add(newPath)
+	if kind, ok := w.settle.rename(oldPath, newPath); ok && kind == settleCreated {
+		// Still being written under its first name: announce it once, under the final one
+		return
+	}
 
 	fileInfo, _ := hardlink.Info(newPath)
 	if fileInfo.Nlink == 0 {
@@ -235,7 +777,7 @@ func (w *FileWatcher) handleRename(oldPath, newPath string) {
 	}
 
 	slog.Info("File renamed", "old_path", oldPath, "new_path", newPath)
-	w.wsClient.SendEvent("file.renamed", models.FileRenamedData{
+	w.publisher.SendEvent("file.renamed", models.FileRenamedData{
 		OldPath:       oldPath,
 		NewPath:       newPath,
 		Name:          filepath.Base(newPath),
@@ -246,7 +788,7 @@ func (w *FileWatcher) handleRename(oldPath, newPath string) {
 	})
 }
 
-func (w *FileWatcher) handleModified(path string) {
+func (w *FileWatcher) emitModified(path, partialHash string) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return
@@ -258,13 +800,14 @@ func (w *FileWatcher) handleModified(path string) {
 	}
 
 	slog.Info("File modified", "path", path)
-	w.wsClient.SendEvent("file.modified", models.FileModifiedData{
+	w.publisher.SendEvent("file.modified", models.FileModifiedData{
 		Path:          path,
 		Name:          filepath.Base(path),
 		SizeBytes:     info.Size(),
 		HardlinkCount: fileInfo.Nlink,
 		Inode:         fileInfo.Inode,
 		DeviceID:      fileInfo.DeviceID,
+		PartialHash:   partialHash,
 	})
 }
 
@@ -285,7 +828,12 @@ func (w *FileWatcher) cleanupLoop() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
 		w.mu.Lock()
 		now := time.Now()
 		for key, ts := range w.recentEvents {
@@ -296,3 +844,22 @@ func (w *FileWatcher) cleanupLoop() {
 		w.mu.Unlock()
 	}
 }
+
+// volumeLoop checks every watch path for availability, so an unmount is noticed
+// even when nothing is deleted.
+func (w *FileWatcher) volumeLoop() {
+	ticker := time.NewTicker(volumeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		for _, root := range w.registry.rootList() {
+			// A stuck probe must not hold up the other paths
+			go w.volumes.check(root)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
+)
+
+// startWatcher starts a FileWatcher on root with the given backend and stops it at cleanup.
+func startWatcher(t *testing.T, b backend, root string) (*FileWatcher, *publisher.Recorder) {
+	t.Helper()
+	rec := publisher.NewRecorder()
+	w := newWithBackend(rec, []string{root}, b)
+	w.SetSettleWindow(100 * time.Millisecond)
+	if err := w.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	return w, rec
+}
+
+// waitForEvents polls until rec holds n events of eventType, and returns them.
+func waitForEvents(t *testing.T, rec *publisher.Recorder, eventType string, n int) []models.Message {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if events := rec.EventsOfType(eventType); len(events) >= n {
+			return events
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("got %d %s events, want %d (all events: %v)", len(rec.EventsOfType(eventType)), eventType, n, rec.Events())
+	return nil
+}
+
+func writeFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInotify_RenameAcrossWatchedDirs(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "incoming"), filepath.Join(root, "movies")
+	for _, d := range []string{src, dst} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPath, newPath := filepath.Join(src, "film.mkv"), filepath.Join(dst, "Film (2024).mkv")
+	writeFile(t, oldPath)
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	events := waitForEvents(t, rec, "file.renamed", 1)
+	data := events[0].Data.(models.FileRenamedData)
+	if data.OldPath != oldPath || data.NewPath != newPath {
+		t.Errorf("renamed %s → %s, want %s → %s", data.OldPath, data.NewPath, oldPath, newPath)
+	}
+	if n := len(rec.EventsOfType("file.deleted")) + len(rec.EventsOfType("file.created")); n != 0 {
+		t.Errorf("got %d created/deleted events, want none for a rename", n)
+	}
+}
+
+func TestInotify_ConcurrentRenamesPairByCookie(t *testing.T) {
+	root := t.TempDir()
+	const n = 20
+	for i := 0; i < n; i++ {
+		writeFile(t, filepath.Join(root, fmt.Sprintf("a%02d.mkv", i)))
+	}
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	done := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			_ = os.Rename(filepath.Join(root, fmt.Sprintf("a%02d.mkv", i)), filepath.Join(root, fmt.Sprintf("b%02d.mkv", i)))
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+
+	for _, ev := range waitForEvents(t, rec, "file.renamed", n) {
+		data := ev.Data.(models.FileRenamedData)
+		if filepath.Base(data.OldPath)[1:] != filepath.Base(data.NewPath)[1:] {
+			t.Errorf("mis-paired rename %s → %s", data.OldPath, data.NewPath)
+		}
+	}
+}
+
+func TestInotify_MoveOutAndIn(t *testing.T) {
+	watched, outside := t.TempDir(), t.TempDir()
+	leaving, arriving := filepath.Join(watched, "leaving.mkv"), filepath.Join(outside, "arriving.mkv")
+	writeFile(t, leaving)
+	writeFile(t, arriving)
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, watched)
+
+	if err := os.Rename(leaving, filepath.Join(outside, "leaving.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(arriving, filepath.Join(watched, "arriving.mkv")); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := waitForEvents(t, rec, "file.deleted", 1)
+	if p := deleted[0].Data.(models.FileDeletedData).Path; p != leaving {
+		t.Errorf("deleted path = %s, want %s", p, leaving)
+	}
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != filepath.Join(watched, "arriving.mkv") {
+		t.Errorf("created path = %s, want %s", p, filepath.Join(watched, "arriving.mkv"))
+	}
+}
+
+func TestInotify_MovedDirectoryKeepsWatching(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "Show.S01")
+	if err := os.Mkdir(oldDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	newDir := filepath.Join(root, "Show (2024)")
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	writeFile(t, filepath.Join(newDir, "e01.mkv"))
+
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != filepath.Join(newDir, "e01.mkv") {
+		t.Errorf("created path = %s, want it under the new directory name", p)
+	}
+}
+
+func TestFsnotify_RenamePairsWithNextCreate(t *testing.T) {
+	root := t.TempDir()
+	oldPath, newPath := filepath.Join(root, "film.mkv"), filepath.Join(root, "renamed.mkv")
+	writeFile(t, oldPath)
+
+	b, err := newFsnotifyBackend()
+	if err != nil {
+		t.Fatalf("newFsnotifyBackend() returned error: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	data := waitForEvents(t, rec, "file.renamed", 1)[0].Data.(models.FileRenamedData)
+	if data.OldPath != oldPath || data.NewPath != newPath {
+		t.Errorf("renamed %s → %s, want %s → %s", data.OldPath, data.NewPath, oldPath, newPath)
+	}
+}
+
+func TestInotify_DirectoryRenamePropagatesToFiles(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "Movie.2024.1080p")
+	if err := os.MkdirAll(filepath.Join(oldDir, "Extras"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(oldDir, "movie.mkv"))
+	writeFile(t, filepath.Join(oldDir, "Extras", "trailer.mp4"))
+	writeFile(t, filepath.Join(oldDir, "movie.nfo"))
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	newDir := filepath.Join(root, "Movie (2024)")
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+
+	events := waitForEvents(t, rec, "file.renamed", 2)
+	want := map[string]string{
+		filepath.Join(oldDir, "Extras", "trailer.mp4"): filepath.Join(newDir, "Extras", "trailer.mp4"),
+		filepath.Join(oldDir, "movie.mkv"):             filepath.Join(newDir, "movie.mkv"),
+	}
+	for _, ev := range events {
+		data := ev.Data.(models.FileRenamedData)
+		if want[data.OldPath] != data.NewPath {
+			t.Errorf("unexpected rename %s → %s", data.OldPath, data.NewPath)
+		}
+		delete(want, data.OldPath)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing renames: %v", want)
+	}
+
+	// The moved subdirectory is still watched under its new path
+	writeFile(t, filepath.Join(newDir, "Extras", "featurette.mkv"))
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != filepath.Join(newDir, "Extras", "featurette.mkv") {
+		t.Errorf("created path = %s", p)
+	}
+}
+
+func TestFsnotify_DirectoryRenamePropagatesToFiles(t *testing.T) {
+	root := t.TempDir()
+	oldDir := filepath.Join(root, "Show.S01")
+	if err := os.Mkdir(oldDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(oldDir, "e01.mkv"))
+
+	b, err := newFsnotifyBackend()
+	if err != nil {
+		t.Fatalf("newFsnotifyBackend() returned error: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	newDir := filepath.Join(root, "Show (2024)")
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+
+	data := waitForEvents(t, rec, "file.renamed", 1)[0].Data.(models.FileRenamedData)
+	if data.OldPath != filepath.Join(oldDir, "e01.mkv") || data.NewPath != filepath.Join(newDir, "e01.mkv") {
+		t.Errorf("renamed %s → %s", data.OldPath, data.NewPath)
+	}
+}
+
+func TestInotify_DirectoryMovedInAnnouncesFiles(t *testing.T) {
+	watched, outside := t.TempDir(), t.TempDir()
+	release := filepath.Join(outside, "Release")
+	if err := os.Mkdir(release, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(release, "movie.mkv"))
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, watched)
+
+	if err := os.Rename(release, filepath.Join(watched, "Release")); err != nil {
+		t.Fatal(err)
+	}
+
+	created := waitForEvents(t, rec, "file.created", 1)
+	if p := created[0].Data.(models.FileCreatedData).Path; p != filepath.Join(watched, "Release", "movie.mkv") {
+		t.Errorf("created path = %s", p)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := len(rec.EventsOfType("file.created")); n != 1 {
+		t.Errorf("got %d file.created events, want 1", n)
+	}
+}
+
+func TestInotify_RemovedTreeDeletesEveryFileOnce(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "Release")
+	if err := os.MkdirAll(filepath.Join(release, "Subs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(release, "movie.mkv"))
+	writeFile(t, filepath.Join(release, "Subs", "sample.mkv"))
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	_, rec := startWatcher(t, b, root)
+
+	if err := os.RemoveAll(release); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForEvents(t, rec, "file.deleted", 2)
+	time.Sleep(200 * time.Millisecond)
+	seen := map[string]int{}
+	for _, ev := range rec.EventsOfType("file.deleted") {
+		seen[ev.Data.(models.FileDeletedData).Path]++
+	}
+	for _, p := range []string{filepath.Join(release, "movie.mkv"), filepath.Join(release, "Subs", "sample.mkv")} {
+		if seen[p] != 1 {
+			t.Errorf("%s deleted %d times, want 1", p, seen[p])
+		}
+	}
+}
+
+func TestHandleEvent_DirRemovedWithLostFileEvents(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "Release")
+	if err := os.MkdirAll(filepath.Join(release, "Subs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(release, "movie.mkv"))
+	writeFile(t, filepath.Join(release, "Subs", "sample.mkv"))
+
+	b, err := newFsnotifyBackend()
+	if err != nil {
+		t.Fatalf("newFsnotifyBackend() returned error: %v", err)
+	}
+	defer b.Close()
+	rec := publisher.NewRecorder()
+	w := newWithBackend(rec, []string{root}, b)
+	_ = w.addRecursive(root, false)
+
+	// Only the directory removal is seen, as when file events were lost
+	if err := os.RemoveAll(release); err != nil {
+		t.Fatal(err)
+	}
+	w.handleEvent(event{path: release, op: opRemove})
+
+	deleted := rec.EventsOfType("file.deleted")
+	if len(deleted) != 2 {
+		t.Fatalf("got %d file.deleted events, want 2", len(deleted))
+	}
+	if p := deleted[0].Data.(models.FileDeletedData).Path; p != filepath.Join(release, "Subs", "sample.mkv") {
+		t.Errorf("first deleted path = %s", p)
+	}
+	for _, dir := range b.WatchList() {
+		if within(dir, release) {
+			t.Errorf("watch on %s not removed", dir)
+		}
+	}
+}
+
+func TestFileWatcher_RemovePathUnwatchesSubtree(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "Film (2024)", "Subs")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w, rec := startWatcher(t, b, root)
+
+	if err := w.RemovePath(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.WatchList(); len(got) != 0 {
+		t.Errorf("still watching %v after RemovePath", got)
+	}
+	writeFile(t, filepath.Join(sub, "film.mkv"))
+	time.Sleep(300 * time.Millisecond)
+	if events := rec.Events(); len(events) != 0 {
+		t.Errorf("got events after RemovePath: %v", events)
+	}
+}
+
+func TestFileWatcher_NestedRootsReportOnce(t *testing.T) {
+	root := t.TempDir()
+	movies := filepath.Join(root, "movies")
+	if err := os.Mkdir(movies, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := newInotifyBackend()
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w, rec := startWatcher(t, b, root)
+	if err := w.AddPath(movies + "/"); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.GetWatchedPaths(); len(got) != 2 {
+		t.Errorf("watched paths = %v, want 2", got)
+	}
+
+	writeFile(t, filepath.Join(movies, "a.mkv"))
+	waitForEvents(t, rec, "file.created", 1)
+
+	// Removing the outer root keeps the nested one watched
+	if err := w.RemovePath(root); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(movies, "b.mkv"))
+	writeFile(t, filepath.Join(root, "c.mkv"))
+	time.Sleep(300 * time.Millisecond)
+	created := rec.EventsOfType("file.created")
+	if len(created) != 2 {
+		t.Fatalf("got %d file.created events, want 2 (all events: %v)", len(created), rec.Events())
+	}
+	if p := created[1].Data.(models.FileCreatedData).Path; p != filepath.Join(movies, "b.mkv") {
+		t.Errorf("second created path = %s, want %s", p, filepath.Join(movies, "b.mkv"))
+	}
+}
+
+func TestFileWatcher_OverflowRescansAffectedRoots(t *testing.T) {
+	lossy, intact := t.TempDir(), t.TempDir()
+	a := newStubBackend("a", intact)
+	b := newStubBackend("b")
+	rec := publisher.NewRecorder()
+	w := newWithBackend(rec, []string{lossy, intact}, newRoutedBackend(a, b))
+	w.overflowDelay = 50 * time.Millisecond
+	rescanned := make(chan []string, 4)
+	w.OnOverflow = func(paths []string) { rescanned <- paths }
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+
+	// Changes the backend never reported
+	lost := filepath.Join(lossy, "Film (2024)")
+	if err := os.Mkdir(lost, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(lost, "film.mkv"))
+
+	w.handleEvent(event{op: opOverflow, source: a})
+	w.handleEvent(event{op: opOverflow, source: a})
+
+	select {
+	case paths := <-rescanned:
+		if len(paths) != 1 || paths[0] != lossy {
+			t.Errorf("rescanned %v, want [%s]", paths, lossy)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnOverflow not called")
+	}
+	select {
+	case paths := <-rescanned:
+		t.Errorf("overflows not coalesced: second rescan of %v", paths)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if !a.dirs[lost] {
+		t.Errorf("directory created during the overflow is not watched")
+	}
+	if !w.index.has(filepath.Join(lost, "film.mkv")) {
+		t.Errorf("file created during the overflow is not indexed")
+	}
+	if events := rec.Events(); len(events) != 0 {
+		t.Errorf("re-sync sent events, want the rescan to report changes: %v", events)
+	}
+}
+
+// TestFileWatcher_OverflowReplacedTimerDoesNotRescan verifies a timer that fired
+// while another overflow replaced it does not rescan on its own.
+func TestFileWatcher_OverflowReplacedTimerDoesNotRescan(t *testing.T) {
+	root := t.TempDir()
+	w := newWithBackend(publisher.NewRecorder(), []string{root}, newStubBackend("a"))
+	w.overflowDelay = time.Hour
+	rescans := 0
+	w.OnOverflow = func([]string) { rescans++ }
+	t.Cleanup(func() { _ = w.Close() })
+
+	w.handleOverflow(nil)
+	w.mu.Lock()
+	stale := w.overflowGen
+	w.mu.Unlock()
+	w.handleOverflow(nil)
+
+	// The first timer's callback runs late, after the second overflow replaced it
+	w.rescanOverflowed(stale)
+	if rescans != 0 {
+		t.Fatalf("replaced timer rescanned %d times, want none", rescans)
+	}
+	w.mu.Lock()
+	current := w.overflowGen
+	w.mu.Unlock()
+	w.rescanOverflowed(current)
+	if rescans != 1 {
+		t.Errorf("current timer rescanned %d times, want 1", rescans)
+	}
+}
+
+func TestFileWatcher_OverflowStormRescannedByDeadline(t *testing.T) {
+	root := t.TempDir()
+	w := newWithBackend(publisher.NewRecorder(), []string{root}, newStubBackend("a"))
+	w.overflowDelay = 100 * time.Millisecond
+	w.overflowMaxDelay = 300 * time.Millisecond
+	rescanned := make(chan time.Time, 4)
+	w.OnOverflow = func([]string) { rescanned <- time.Now() }
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+
+	// Overflows keep coming faster than the quiet delay
+	stop := make(chan struct{})
+	defer close(stop)
+	first := time.Now()
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			w.handleOverflow(nil)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	select {
+	case at := <-rescanned:
+		if wait := at.Sub(first); wait > time.Second {
+			t.Errorf("rescan %v after the first overflow, want about the 300ms maximum", wait)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("rescan postponed for as long as the storm lasted")
+	}
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import "sync"
+
+// ackWindowSize bounds the number of sent-but-unacknowledged events kept for resend.
+const ackWindowSize = 10000
+
+// sentEvent is an event written to the socket and still awaiting a watcher.ack.
+type sentEvent struct {
+	bootID string
+	seq    uint64
+	raw    []byte
+
+	// held is the queue that still holds the event until it is acknowledged, if any.
+	held outbox
+}
+
+// ackWindow tracks sent events until the API acknowledges them.
+// Acks are cumulative per boot ID: acking seq N acknowledges every event <= N.
+type ackWindow struct {
+	mu     sync.Mutex
+	events []sentEvent
+	max    int
+
+	// evicted holds, per boot ID, the highest seq dropped from a full window before it was acked.
+	evicted map[string]uint64
+}
+
+func newAckWindow(max int) *ackWindow {
+	return &ackWindow{max: max, evicted: make(map[string]uint64)}
+}
+
+// add records a sent event. Returns false if the oldest entry had to be evicted
+// because the window is full (that event can no longer be resent).
+func (w *ackWindow) add(bootID string, seq uint64, raw []byte) bool {
+	return w.addHeld(bootID, seq, raw, nil)
+}
+
+// addHeld is add for an event that held still holds: held.Ack is called once the
+// event is acknowledged or evicted.
+func (w *ackWindow) addHeld(bootID string, seq uint64, raw []byte, held outbox) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	evicted := false
+	if len(w.events) >= w.max {
+		oldest := w.events[0]
+		w.evicted[oldest.bootID] = oldest.seq
+		if oldest.held != nil {
+			oldest.held.Ack(1)
+		}
+		w.events[0] = sentEvent{}
+		w.events = w.events[1:]
+		evicted = true
+	}
+	w.events = append(w.events, sentEvent{bootID: bootID, seq: seq, raw: raw, held: held})
+	return !evicted
+}
+
+// ack drops every event of bootID with a sequence <= seq and releases them from
+// the queues holding them. Returns the number removed.
+func (w *ackWindow) ack(bootID string, seq uint64) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	kept := w.events[:0]
+	removed := 0
+	release := make(map[outbox]int)
+	for _, e := range w.events {
+		if e.bootID == bootID && e.seq <= seq {
+			removed++
+			if e.held != nil {
+				release[e.held]++
+			}
+			continue
+		}
+		kept = append(kept, e)
+	}
+	for i := len(kept); i < len(w.events); i++ {
+		w.events[i] = sentEvent{}
+	}
+	w.events = kept
+	for q, n := range release {
+		q.Ack(n)
+	}
+	return removed
+}
+
+// since returns the events of bootID with a sequence >= fromSeq, in send order.
+// ok is false if events in that range were already evicted and cannot be replayed.
+func (w *ackWindow) since(bootID string, fromSeq uint64) (events [][]byte, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, e := range w.events {
+		if e.bootID == bootID && e.seq >= fromSeq {
+			events = append(events, e.raw)
+		}
+	}
+	return events, fromSeq > w.evicted[bootID]
+}
+
+// all returns every unacknowledged event, in send order.
+func (w *ackWindow) all() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	out := make([][]byte, len(w.events))
+	for i, e := range w.events {
+		out[i] = e.raw
+	}
+	return out
+}
+
+// len returns the number of unacknowledged events.
+func (w *ackWindow) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.events)
+}
@@ -0,0 +1,60 @@
+package websocket
+
+import "testing"
+
+// TestAckWindow_CumulativeAck verifies an ack removes every event up to its sequence.
+func TestAckWindow_CumulativeAck(t *testing.T) {
+	w := newAckWindow(100)
+	for seq := uint64(1); seq <= 5; seq++ {
+		w.add("boot-a", seq, []byte(`{}`))
+	}
+
+	if removed := w.ack("boot-a", 3); removed != 3 {
+		t.Errorf("ack removed %d, want 3", removed)
+	}
+	if w.len() != 2 {
+		t.Errorf("len() = %d, want 2", w.len())
+	}
+
+	// Acks for another boot must not touch these events.
+	if removed := w.ack("boot-b", 10); removed != 0 {
+		t.Errorf("ack for other boot removed %d, want 0", removed)
+	}
+}
+
+// TestAckWindow_Since verifies replay returns events from the requested sequence.
+func TestAckWindow_Since(t *testing.T) {
+	w := newAckWindow(100)
+	for seq := uint64(1); seq <= 5; seq++ {
+		w.add("boot-a", seq, []byte(`{}`))
+	}
+	w.ack("boot-a", 2)
+
+	events, ok := w.since("boot-a", 4)
+	if !ok {
+		t.Error("since() ok = false, want true")
+	}
+	if len(events) != 2 {
+		t.Errorf("since() returned %d events, want 2", len(events))
+	}
+}
+
+// TestAckWindow_EvictionReportsGap verifies replay of evicted events is reported as a gap.
+func TestAckWindow_EvictionReportsGap(t *testing.T) {
+	w := newAckWindow(3)
+	for seq := uint64(1); seq <= 3; seq++ {
+		if !w.add("boot-a", seq, []byte(`{}`)) {
+			t.Fatalf("add(%d) evicted before the window was full", seq)
+		}
+	}
+	if w.add("boot-a", 4, []byte(`{}`)) {
+		t.Error("add() on a full window returned true, want false")
+	}
+
+	if _, ok := w.since("boot-a", 1); ok {
+		t.Error("since(1) ok = true after seq 1 was evicted, want false")
+	}
+	if _, ok := w.since("boot-a", 2); !ok {
+		t.Error("since(2) ok = false, want true")
+	}
+}
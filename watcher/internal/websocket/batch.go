@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// defaultScanBatchFlush is used when the API enables batching without a flush delay.
+const defaultScanBatchFlush = 250 * time.Millisecond
+
+// scanBatcher coalesces scan.file events into scan.files messages.
+//
+// A batch is sent when it reaches maxFiles, when flushAfter elapses since its first
+// file, or right before any other scan event is sent. The last rule keeps the stream
+// ordered: scan.progress and scan.completed never overtake the files they cover.
+//
+// sendMu is held from taking batches until they are sent, so a batch taken by the
+// timer cannot be overtaken by an event that flushed the batcher meanwhile. mu is
+// released while sending: sending may log (a full lane), and a log forwarded to
+// the API comes back through SendEvent, which checks whether batching is enabled.
+type scanBatcher struct {
+	sendMu sync.Mutex
+
+	mu         sync.Mutex
+	maxFiles   int
+	flushAfter time.Duration
+	pending    map[string][]models.ScanFileData
+	order      []string // scan IDs in first-seen order
+	timer      *time.Timer
+	send       func(models.Message)
+}
+
+func newScanBatcher(send func(models.Message)) *scanBatcher {
+	return &scanBatcher{
+		pending: make(map[string][]models.ScanFileData),
+		send:    send,
+	}
+}
+
+// configure sets the batch limits. maxFiles <= 1 disables batching.
+func (b *scanBatcher) configure(maxFiles int, flushAfter time.Duration) {
+	if flushAfter <= 0 {
+		flushAfter = defaultScanBatchFlush
+	}
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	b.mu.Lock()
+	b.maxFiles = maxFiles
+	b.flushAfter = flushAfter
+	var batches []models.Message
+	if maxFiles <= 1 {
+		batches = b.takeLocked()
+	}
+	b.mu.Unlock()
+	b.sendAll(batches)
+}
+
+// enabled reports whether scan.file events should be batched.
+func (b *scanBatcher) enabled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.maxFiles > 1
+}
+
+// add queues a file. Returns false if batching is disabled and the caller must send it as-is.
+func (b *scanBatcher) add(file models.ScanFileData) bool {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	b.mu.Lock()
+	if b.maxFiles <= 1 {
+		b.mu.Unlock()
+		return false
+	}
+
+	if _, ok := b.pending[file.ScanID]; !ok {
+		b.order = append(b.order, file.ScanID)
+	}
+	b.pending[file.ScanID] = append(b.pending[file.ScanID], file)
+
+	var batches []models.Message
+	if len(b.pending[file.ScanID]) >= b.maxFiles {
+		batches = b.takeLocked()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.flushAfter, b.flush)
+	}
+	b.mu.Unlock()
+	b.sendAll(batches)
+	return true
+}
+
+// flush sends every pending batch.
+func (b *scanBatcher) flush() {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+	b.mu.Lock()
+	batches := b.takeLocked()
+	b.mu.Unlock()
+	b.sendAll(batches)
+}
+
+// sendAll sends batches in order. Called with b.sendMu held.
+func (b *scanBatcher) sendAll(batches []models.Message) {
+	for _, msg := range batches {
+		b.send(msg)
+	}
+}
+
+// takeLocked empties the pending batches and returns them as scan.files messages.
+// Called with b.mu held.
+func (b *scanBatcher) takeLocked() []models.Message {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	var batches []models.Message
+	for _, scanID := range b.order {
+		files := b.pending[scanID]
+		if len(files) == 0 {
+			continue
+		}
+		batches = append(batches, models.Message{
+			Type:      "scan.files",
+			Timestamp: time.Now().UTC(),
+			Data: models.ScanFilesData{
+				ScanID: scanID,
+				Files:  files,
+			},
+		})
+	}
+	b.pending = make(map[string][]models.ScanFileData)
+	b.order = nil
+	return batches
+}
@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voclinx/scanarr-watcher/internal/logger"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// sentLog records messages handed to the batcher's send function.
+type sentLog struct {
+	mu   sync.Mutex
+	msgs []models.Message
+}
+
+func (l *sentLog) send(msg models.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *sentLog) snapshot() []models.Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]models.Message(nil), l.msgs...)
+}
+
+// TestScanBatcher_FlushesAtMaxFiles verifies a batch is sent once it is full.
+func TestScanBatcher_FlushesAtMaxFiles(t *testing.T) {
+	log := &sentLog{}
+	b := newScanBatcher(log.send)
+	b.configure(3, time.Hour)
+
+	for i := 0; i < 7; i++ {
+		if !b.add(models.ScanFileData{ScanID: "scan-1"}) {
+			t.Fatal("add() returned false with batching enabled")
+		}
+	}
+
+	msgs := log.snapshot()
+	if len(msgs) != 2 {
+		t.Fatalf("sent %d batches, want 2", len(msgs))
+	}
+	for _, msg := range msgs {
+		data := msg.Data.(models.ScanFilesData)
+		if msg.Type != "scan.files" || data.ScanID != "scan-1" || len(data.Files) != 3 {
+			t.Errorf("batch = %s %s %d files, want scan.files scan-1 3 files", msg.Type, data.ScanID, len(data.Files))
+		}
+	}
+
+	b.flush()
+	if msgs := log.snapshot(); len(msgs) != 3 || len(msgs[2].Data.(models.ScanFilesData).Files) != 1 {
+		t.Errorf("flush() did not send the remaining file")
+	}
+}
+
+// TestScanBatcher_FlushesAfterDelay verifies a partial batch is sent after flushAfter.
+func TestScanBatcher_FlushesAfterDelay(t *testing.T) {
+	log := &sentLog{}
+	b := newScanBatcher(log.send)
+	b.configure(100, 50*time.Millisecond)
+
+	b.add(models.ScanFileData{ScanID: "scan-1"})
+	time.Sleep(200 * time.Millisecond)
+
+	if msgs := log.snapshot(); len(msgs) != 1 {
+		t.Errorf("sent %d batches after delay, want 1", len(msgs))
+	}
+}
+
+// TestScanBatcher_Disabled verifies add refuses files when batching is off.
+func TestScanBatcher_Disabled(t *testing.T) {
+	log := &sentLog{}
+	b := newScanBatcher(log.send)
+
+	if b.enabled() {
+		t.Error("enabled() = true by default, want false")
+	}
+	if b.add(models.ScanFileData{ScanID: "scan-1"}) {
+		t.Error("add() = true with batching disabled, want false")
+	}
+}
+
+// TestClient_ScanBatching_KeepsOrder verifies pending files are sent before the next non-file event.
+func TestClient_ScanBatching_KeepsOrder(t *testing.T) {
+	client := NewClient("ws://localhost:9999/ws", "my-watcher-id")
+	client.SetScanBatching(100, time.Hour)
+
+	client.SendEvent("scan.file", models.ScanFileData{ScanID: "scan-1", Path: "/a.mkv"})
+	client.SendEvent("scan.file", models.ScanFileData{ScanID: "scan-1", Path: "/b.mkv"})
+	client.SendEvent("scan.completed", models.ScanCompletedData{ScanID: "scan-1"})
+
+	if client.QueueLen() != 2 {
+		t.Fatalf("QueueLen() = %d, want 2 (scan.files + scan.completed)", client.QueueLen())
+	}
+	raw, _ := client.lanes[laneScan].q.Peek()
+	var first models.Message
+	if err := json.Unmarshal(raw, &first); err != nil {
+		t.Fatalf("failed to decode queued message: %v", err)
+	}
+	if first.Type != "scan.files" {
+		t.Errorf("first queued message type = %q, want %q", first.Type, "scan.files")
+	}
+}
+
+// TestScanBatcher_FlushInProgressNotOvertaken verifies an event that flushes the
+// batcher waits for a batch the timer is still sending.
+func TestScanBatcher_FlushInProgressNotOvertaken(t *testing.T) {
+	log := &sentLog{}
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	b := newScanBatcher(func(msg models.Message) {
+		once.Do(func() {
+			close(sending)
+			<-release
+		})
+		log.send(msg)
+	})
+	b.configure(100, 10*time.Millisecond)
+	b.add(models.ScanFileData{ScanID: "scan-1"})
+
+	// The timer took the batch and is sending it
+	<-sending
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.flush()
+		log.send(models.Message{Type: "scan.completed"})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-done
+
+	msgs := log.snapshot()
+	if len(msgs) != 2 || msgs[0].Type != "scan.files" || msgs[1].Type != "scan.completed" {
+		var types []string
+		for _, m := range msgs {
+			types = append(types, m.Type)
+		}
+		t.Errorf("sent %v, want [scan.files scan.completed]", types)
+	}
+}
+
+// TestClient_ScanBatching_LogsDoNotFlush verifies events other than scan events
+// leave pending files batched.
+func TestClient_ScanBatching_LogsDoNotFlush(t *testing.T) {
+	client := NewClient("ws://localhost:9999/ws", "my-watcher-id")
+	client.SetScanBatching(100, time.Hour)
+
+	client.SendEvent("scan.file", models.ScanFileData{ScanID: "scan-1", Path: "/a.mkv"})
+	client.ForwardLog("info", "log line", nil)
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/b.mkv"})
+
+	if n := client.QueueDepths()["scan"]; n != 0 {
+		t.Errorf("scan lane holds %d messages, want the file still batched", n)
+	}
+	client.SendEvent("scan.progress", models.ScanProgressData{ScanID: "scan-1"})
+	if n := client.QueueDepths()["scan"]; n != 2 {
+		t.Errorf("scan lane holds %d messages, want scan.files + scan.progress", n)
+	}
+}
+
+// TestScanBatcher_FullLaneWithLogForwarding fills the scan lane while logs are
+// forwarded to the API: the "buffer full" warning sent while a batch is flushed
+// comes back through SendEvent and must not wait on the batcher.
+func TestScanBatcher_FullLaneWithLogForwarding(t *testing.T) {
+	prev := slog.Default()
+	logger.Setup("error")
+	defer slog.SetDefault(prev)
+
+	c := NewClient("ws://127.0.0.1:1/ws", "test-watcher")
+	logger.SetLevel("warn")
+	logger.SetForwarder(c)
+	defer logger.SetForwarder(nil)
+	c.SetScanBatching(2, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 30000; i++ {
+			c.SendEvent("scan.file", models.ScanFileData{ScanID: "scan-1"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SendEvent blocked: batcher deadlocked on a forwarded log")
+	}
+	if drops := c.QueueDrops()["scan"]; drops == 0 {
+		t.Errorf("scan lane drops = %d, want > 0 (the lane was meant to overflow)", drops)
+	}
+}
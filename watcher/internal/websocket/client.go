@@ -2,17 +2,26 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"net"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	gorilla_ws "github.com/gorilla/websocket"
 	"github.com/voclinx/scanarr-watcher/internal/models"
+	"github.com/voclinx/scanarr-watcher/internal/publisher"
 )
 
+// errStaleConn is returned when writing to a connection that has since been replaced.
+var errStaleConn = errors.New("connection replaced")
+
 // Client is a WebSocket client with automatic reconnection and the new hello/auth protocol.
 type Client struct {
 	url       string
@@ -25,14 +34,48 @@ type Client struct {
 	// configHash is the hash of the last received config.
 	configHash atomic.Pointer[string]
 
+	// protocol is what the API pinned in its last watcher.config (see protocol.go).
+	protocol atomic.Pointer[Protocol]
+
 	reconnectDelay atomic.Int64 // nanoseconds
 	pingInterval   atomic.Int64 // nanoseconds
 
+	// pingReset wakes the ping loop when the interval changes.
+	pingReset chan struct{}
+
+	// lastPong is when the current connection last answered a ping (unix nanoseconds).
+	lastPong atomic.Int64
+
+	// dialer is a copy of the default dialer, carrying the TLS settings for wss://.
+	dialer *gorilla_ws.Dialer
+
 	conn      *gorilla_ws.Conn
 	mu        sync.Mutex
 	done      chan struct{}
 	closeOnce sync.Once
-	msgChan   chan models.Message
+
+	// writable is closed once the current connection is approved (watcher.config
+	// received), or once it is dropped. The write loop waits for it: the API drops
+	// every message of a connection that is not authenticated yet. Guarded by mu.
+	writable chan struct{}
+
+	// lanes hold encoded messages until they are written, one queue per priority
+	// class. In-memory by default; EnableSpool moves all but the log lane to disk.
+	lanes [laneCount]*laneQueue
+
+	// bootID identifies this watcher process; seq numbers outbound events within it.
+	// Sequence numbers are assigned at write time so they follow wire order across lanes.
+	bootID string
+	seq    atomic.Uint64
+
+	// acks holds sent events until the API acknowledges them with watcher.ack.
+	// acksEnabled is set once the API has sent its first ack: older APIs never ack,
+	// so resend-on-reconnect only kicks in when we know the API deduplicates by seq.
+	acks        *ackWindow
+	acksEnabled atomic.Bool
+
+	// batcher coalesces scan.file events into scan.files once the API enables it.
+	batcher *scanBatcher
 
 	// droppedMessages is set to true when the buffer overflows.
 	droppedMessages atomic.Bool
@@ -43,24 +86,52 @@ type Client struct {
 	// reconnecting prevents concurrent reconnection attempts.
 	reconnecting atomic.Bool
 
-	// OnCommand is called when a command is received from the API.
+	// state is the current lifecycle State (see state.go).
+	state atomic.Int32
+
+	// callbacks queues the OnCommand and OnConfig calls, run one at a time and in
+	// order by callbackLoop. The read loop must keep reading while they run, or
+	// pongs go unread and a healthy connection is dropped as dead.
+	callbacks     chan func()
+	callbacksOnce sync.Once
+
+	// OnCommand is called when a command is received from the API, on a goroutine
+	// of its own: commands and configs are delivered one at a time, in order.
 	OnCommand func(msg models.Message)
 
 	// OnReconnect is called after a successful reconnection if messages were dropped.
 	OnReconnect func()
 
-	// OnConfig is called when the API sends a new config (watcher.config message).
+	// OnConfig is called when the API sends a new config (watcher.config message),
+	// in order with OnCommand.
 	OnConfig func(config models.WatcherConfigData)
+
+	// OnStateChange is called on every lifecycle transition.
+	OnStateChange func(from, to State)
+
+	// OnRejected is called when the API rejects our token, after it was cleared in
+	// memory, in order with OnConfig and OnCommand.
+	OnRejected func()
 }
 
 // NewClient creates a new WebSocket client with the new protocol.
 func NewClient(url, watcherID string) *Client {
+	dialer := *gorilla_ws.DefaultDialer
 	c := &Client{
+		dialer:    &dialer,
 		url:       url,
 		watcherID: watcherID,
 		done:      make(chan struct{}),
-		msgChan:   make(chan models.Message, 10000),
+		pingReset: make(chan struct{}, 1),
+		lanes:     newLanes(),
+		bootID:    uuid.New().String(),
+		acks:      newAckWindow(ackWindowSize),
+		callbacks: make(chan func(), callbackQueue),
 	}
+	c.batcher = newScanBatcher(c.Send)
+
+	// Negotiate permessage-deflate; the API may decline, in which case frames are sent uncompressed.
+	c.dialer.EnableCompression = true
 
 	// Set sensible defaults for timing
 	c.reconnectDelay.Store(int64(5 * time.Second))
@@ -90,14 +161,141 @@ func (c *Client) GetConfigHash() string {
 	return ""
 }
 
+// SetTLSConfig configures CA bundle, client certificate and SPKI pins for wss:// connections.
+// Files are loaded immediately so misconfiguration is reported at startup.
+// Must be called before Connect/ConnectWithRetry.
+func (c *Client) SetTLSConfig(cfg TLSConfig) error {
+	tlsCfg, err := cfg.build()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(c.url, "wss://") {
+		slog.Warn("TLS settings are ignored for a non-wss:// URL", "url", c.url)
+	}
+	c.dialer.TLSClientConfig = tlsCfg
+	slog.Info("TLS configured",
+		"ca_file", cfg.CAFile,
+		"client_cert", cfg.CertFile != "",
+		"pins", len(cfg.PinnedSPKI),
+	)
+	return nil
+}
+
+// SetScanBatching enables scan.files batching of up to maxFiles files, flushed after
+// flushAfter at most. maxFiles <= 1 disables batching (the API does not support it),
+// and so does a negotiated protocol without the scan.batch capability.
+func (c *Client) SetScanBatching(maxFiles int, flushAfter time.Duration) {
+	if !c.Supports(CapScanBatch) {
+		maxFiles = 0
+	}
+	c.batcher.configure(maxFiles, flushAfter)
+}
+
 // SetReconnectDelay sets the base reconnect delay.
 func (c *Client) SetReconnectDelay(d time.Duration) {
 	c.reconnectDelay.Store(int64(d))
 }
 
-// SetPingInterval sets the ping interval.
+// SetPingInterval sets the ping interval. A running connection picks it up immediately.
 func (c *Client) SetPingInterval(d time.Duration) {
-	c.pingInterval.Store(int64(d))
+	if d <= 0 || c.pingInterval.Swap(int64(d)) == int64(d) {
+		return
+	}
+	select {
+	case c.pingReset <- struct{}{}:
+	default:
+	}
+}
+
+// pongTimeout is how long a connection may stay silent before it is considered dead:
+// two ping intervals plus half of one, so a single lost pong is tolerated.
+func (c *Client) pongTimeout() time.Duration {
+	interval := time.Duration(c.pingInterval.Load())
+	return 2*interval + interval/2
+}
+
+// EnableSpool switches the control, live and scan lanes to durable on-disk spools
+// under dir, sharing maxBytes between them. Events pending from a previous run are
+// replayed once connected. Must be called before Connect/ConnectWithRetry.
+func (c *Client) EnableSpool(dir string, maxBytes int64) error {
+	var spools [laneCount]*spool
+	for l, spec := range laneSpecs {
+		if spec.spoolShare == 0 {
+			continue
+		}
+		sp, err := openSpool(spoolDirFor(dir, lane(l)), maxBytes*spec.spoolShare/8)
+		if err != nil {
+			for _, opened := range spools {
+				if opened != nil {
+					_ = opened.Close()
+				}
+			}
+			return err
+		}
+		spools[l] = sp
+	}
+
+	for l, sp := range spools {
+		if sp == nil {
+			continue
+		}
+		// Carry over anything queued in memory before the spool was enabled.
+		old := c.lanes[l].q
+		for {
+			raw, ok := old.Peek()
+			if !ok {
+				break
+			}
+			if err := sp.Push(raw); err != nil {
+				break
+			}
+			old.Pop()
+		}
+		_ = old.Close()
+		c.lanes[l].q = sp
+	}
+
+	migrateLegacySpool(dir, c.lanes)
+
+	slog.Info("Event spool enabled", "dir", dir, "max_bytes", maxBytes, "pending", c.QueueLen())
+	return nil
+}
+
+// BootID returns the per-process ID stamped on every outbound event.
+func (c *Client) BootID() string {
+	return c.bootID
+}
+
+// UnackedLen returns the number of sent events not yet acknowledged by the API.
+func (c *Client) UnackedLen() int {
+	return c.acks.len()
+}
+
+// QueueLen returns the number of events waiting to be sent, across all lanes.
+func (c *Client) QueueLen() int {
+	n := 0
+	for _, lq := range c.lanes {
+		n += lq.q.Len()
+	}
+	return n
+}
+
+// QueueDepths returns the number of events waiting in each lane, keyed by lane name.
+func (c *Client) QueueDepths() map[string]int {
+	depths := make(map[string]int, laneCount)
+	for _, lq := range c.lanes {
+		depths[lq.spec.name] = lq.q.Len()
+	}
+	return depths
+}
+
+// QueueDrops returns the number of events dropped by each lane since startup.
+func (c *Client) QueueDrops() map[string]uint64 {
+	drops := make(map[string]uint64, laneCount)
+	for _, lq := range c.lanes {
+		drops[lq.spec.name] = lq.dropped.Load()
+	}
+	return drops
 }
 
 // Connect establishes the WebSocket connection and starts read/write loops.
@@ -105,9 +303,7 @@ func (c *Client) Connect() error {
 	if err := c.dial(); err != nil {
 		return err
 	}
-	go c.readLoop()
-	go c.writeLoop()
-	go c.pingLoop()
+	c.startLoops()
 	return nil
 }
 
@@ -125,6 +321,7 @@ func (c *Client) ConnectWithRetry() {
 		}
 
 		if err := c.dial(); err != nil {
+			c.setState(StateDisconnected)
 			slog.Warn("WebSocket connection failed, retrying",
 				"error", err,
 				"delay", delay,
@@ -140,9 +337,7 @@ func (c *Client) ConnectWithRetry() {
 		slog.Info("WebSocket connected", "url", c.url, "reconnect", isReconnect)
 		delay = baseDelay // reset backoff
 
-		go c.readLoop()
-		go c.writeLoop()
-		go c.pingLoop()
+		c.startLoops()
 
 		// If this is a reconnection and events were dropped, trigger a resync scan
 		if isReconnect && c.droppedMessages.Swap(false) {
@@ -156,20 +351,45 @@ func (c *Client) ConnectWithRetry() {
 	}
 }
 
-// Send queues a message to be sent over WebSocket.
+// Send queues a message in the lane matching its type.
+// Messages stay queued (on disk when the spool is enabled) until they are written.
 func (c *Client) Send(msg models.Message) {
-	select {
-	case c.msgChan <- msg:
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		slog.Warn("Failed to encode message", "error", err, "type", msg.Type)
+		return
+	}
+
+	lq := c.lanes[laneFor(msg.Type)]
+	err = lq.q.Push(raw)
+	switch {
+	case err == nil:
+	case errors.Is(err, errEvictedOldest):
+		// Lane drops its oldest entry by design (logs): count it, don't warn —
+		// a warning would itself be forwarded into the full lane.
+		lq.dropped.Add(1)
 	default:
-		if !c.droppedMessages.Load() {
-			c.droppedMessages.Store(true)
-			slog.Warn("Message buffer full, events are being dropped — a resync scan will be triggered on reconnection", "type", msg.Type)
+		lq.dropped.Add(1)
+		if !c.droppedMessages.Swap(true) {
+			slog.Warn("Message buffer full, events are being dropped — a resync scan will be triggered on reconnection", "type", msg.Type, "lane", lq.spec.name, "error", err)
 		}
 	}
 }
 
 // SendEvent is a helper to send an event with the current timestamp.
+// scan.file events are coalesced into scan.files when batching is enabled.
 func (c *Client) SendEvent(eventType string, data interface{}) {
+	if c.batcher.enabled() {
+		if file, ok := data.(models.ScanFileData); ok && eventType == "scan.file" {
+			if c.batcher.add(file) {
+				return
+			}
+		} else if strings.HasPrefix(eventType, "scan.") {
+			// Keep ordering: pending files go out before any other scan event.
+			c.batcher.flush()
+		}
+	}
+
 	c.Send(models.Message{
 		Type:      eventType,
 		Timestamp: time.Now().UTC(),
@@ -177,6 +397,9 @@ func (c *Client) SendEvent(eventType string, data interface{}) {
 	})
 }
 
+// Client implements publisher.EventPublisher.
+var _ publisher.EventPublisher = (*Client)(nil)
+
 // ForwardLog sends a log entry to the API as a watcher.log message.
 // Implements the logger.LogForwarder interface.
 func (c *Client) ForwardLog(level, message string, context map[string]interface{}) {
@@ -191,7 +414,9 @@ func (c *Client) ForwardLog(level, message string, context map[string]interface{
 // Close cleanly shuts down the client. It is safe to call multiple times.
 func (c *Client) Close() {
 	c.closeOnce.Do(func() {
+		c.batcher.flush()
 		close(c.done)
+		defer c.setState(StateDisconnected)
 		c.mu.Lock()
 		defer c.mu.Unlock()
 		if c.conn != nil {
@@ -201,6 +426,11 @@ func (c *Client) Close() {
 			)
 			_ = c.conn.Close()
 		}
+		for _, lq := range c.lanes {
+			if err := lq.q.Close(); err != nil {
+				slog.Warn("Failed to close outbound queue", "lane", lq.spec.name, "error", err)
+			}
+		}
 	})
 }
 
@@ -212,13 +442,21 @@ func (c *Client) IsConnected() bool {
 }
 
 func (c *Client) dial() error {
-	conn, _, err := gorilla_ws.DefaultDialer.Dial(c.url, nil)
+	c.setState(StateConnecting)
+
+	conn, resp, err := c.dialer.Dial(c.url, nil)
 	if err != nil {
-		return err
+		return describeDialError(err)
 	}
+	if resp != nil {
+		slog.Debug("WebSocket extensions negotiated", "extensions", resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+
+	c.watchLiveness(conn)
 
 	c.mu.Lock()
 	c.conn = conn
+	c.writable = make(chan struct{})
 	c.mu.Unlock()
 
 	// Send hello or auth depending on whether we have a token
@@ -228,11 +466,7 @@ func (c *Client) dial() error {
 		return c.writeJSON(models.Message{
 			Type:      "watcher.hello",
 			Timestamp: time.Now().UTC(),
-			Data: models.WatcherHelloData{
-				WatcherID: c.watcherID,
-				Hostname:  hostname(),
-				Version:   version(),
-			},
+			Data:      c.helloData(),
 		})
 	}
 
@@ -240,11 +474,7 @@ func (c *Client) dial() error {
 	if err := c.writeJSON(models.Message{
 		Type:      "watcher.hello",
 		Timestamp: time.Now().UTC(),
-		Data: models.WatcherHelloData{
-			WatcherID: c.watcherID,
-			Hostname:  hostname(),
-			Version:   version(),
-		},
+		Data:      c.helloData(),
 	}); err != nil {
 		return err
 	}
@@ -252,6 +482,52 @@ func (c *Client) dial() error {
 	return nil
 }
 
+// startLoops starts the read, write and ping loops for the current connection.
+func (c *Client) startLoops() {
+	c.mu.Lock()
+	conn, writable := c.conn, c.writable
+	c.mu.Unlock()
+
+	go c.readLoop(conn)
+	go c.writeLoop(conn, writable)
+	go c.pingLoop(conn)
+}
+
+// releaseWritesLocked lets the write loop of the current connection start. Called with c.mu held.
+func (c *Client) releaseWritesLocked() {
+	if c.writable == nil {
+		return
+	}
+	select {
+	case <-c.writable:
+	default:
+		close(c.writable)
+	}
+}
+
+// watchLiveness arms the read deadline of a new connection and extends it on every
+// pong. A half-open TCP session (peer gone without a FIN, e.g. dropped by a NAT) then
+// surfaces as a read timeout instead of blocking ReadMessage forever.
+func (c *Client) watchLiveness(conn *gorilla_ws.Conn) {
+	c.lastPong.Store(time.Now().UnixNano())
+	_ = conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
+
+	conn.SetPongHandler(func(string) error {
+		c.lastPong.Store(time.Now().UnixNano())
+		return conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
+	})
+
+	// Pings from the API prove liveness too; answer them like the default handler does.
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
+		err := conn.WriteControl(gorilla_ws.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+		if errors.Is(err, gorilla_ws.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+}
+
 func (c *Client) writeJSON(v interface{}) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -261,7 +537,7 @@ func (c *Client) writeJSON(v interface{}) error {
 	return c.conn.WriteJSON(v)
 }
 
-func (c *Client) readLoop() {
+func (c *Client) readLoop(conn *gorilla_ws.Conn) {
 	for {
 		select {
 		case <-c.done:
@@ -269,20 +545,18 @@ func (c *Client) readLoop() {
 		default:
 		}
 
-		c.mu.Lock()
-		conn := c.conn
-		c.mu.Unlock()
-
-		if conn == nil {
-			return
-		}
-
 		_, rawMsg, err := conn.ReadMessage()
 		if err != nil {
-			slog.Warn("WebSocket read error", "error", err)
-			c.reconnect()
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				slog.Warn("No data or pong received from the API, connection considered dead", "timeout", c.pongTimeout())
+			} else {
+				slog.Warn("WebSocket read error", "error", err)
+			}
+			c.reconnect(conn)
 			return
 		}
+		_ = conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
 
 		var msg models.Message
 		if err := json.Unmarshal(rawMsg, &msg); err != nil {
@@ -298,25 +572,57 @@ func (c *Client) readLoop() {
 			c.handleConfigMessage(rawMsg)
 		case "watcher.pending":
 			slog.Info("Watcher is pending approval by an admin", "watcher_id", c.watcherID)
+			c.setState(StatePendingApproval)
 		case "watcher.rejected":
-			c.handleRejected(rawMsg)
+			c.handleRejected()
+		case "watcher.ack":
+			c.handleAck(rawMsg)
+		case "watcher.replay":
+			c.handleReplay(conn, rawMsg)
 		default:
 			if c.OnCommand != nil {
-				c.OnCommand(msg)
+				c.dispatch(func() { c.OnCommand(msg) })
 			}
 		}
 	}
 }
 
+// callbackQueue is how many commands and configs may wait for the callback
+// running before the read loop blocks.
+const callbackQueue = 256
+
+// dispatch queues f to run after the callbacks queued before it.
+func (c *Client) dispatch(f func()) {
+	c.callbacksOnce.Do(func() { go c.callbackLoop() })
+	select {
+	case c.callbacks <- f:
+	case <-c.done:
+	}
+}
+
+// callbackLoop runs the queued callbacks until the client is closed.
+func (c *Client) callbackLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case f := <-c.callbacks:
+			f()
+		}
+	}
+}
+
 // handleAuthRequired — server is asking us to authenticate.
 func (c *Client) handleAuthRequired() {
 	token := c.GetToken()
 	if token == "" {
 		slog.Warn("Received watcher.auth_required but no token available — waiting for approval")
+		c.setState(StatePendingApproval)
 		return
 	}
 
 	slog.Info("Sending watcher.auth")
+	c.setState(StateAuthenticating)
 	if err := c.writeJSON(models.Message{
 		Type:      "watcher.auth",
 		Timestamp: time.Now().UTC(),
@@ -353,91 +659,305 @@ func (c *Client) handleConfigMessage(rawMsg []byte) {
 		c.configHash.Store(&cfg.ConfigHash)
 	}
 
-	slog.Info("Received config from API", "config_hash", cfg.ConfigHash)
-
-	if c.OnConfig != nil {
-		c.OnConfig(cfg)
+	proto := negotiate(cfg)
+	c.protocol.Store(&proto)
+	if proto.Negotiated() && proto.Has(CapAcks) && !c.acksEnabled.Swap(true) {
+		slog.Info("API acknowledges events — unacknowledged events will be resent after reconnect")
 	}
 
+	slog.Info("Received config from API",
+		"config_hash", cfg.ConfigHash,
+		"protocol_version", proto.Version,
+		"capabilities", proto.Capabilities,
+	)
+	c.setState(StateApproved)
+
 	// First-time approval: reconnect so we go through the full watcher.auth flow
 	// and the server marks us as "connected" in the database.
-	if wasUnauthenticated && cfg.AuthToken != "" {
-		slog.Info("First-time approval received — reconnecting to authenticate")
-		go c.reconnect()
+	firstApproval := wasUnauthenticated && cfg.AuthToken != ""
+	c.mu.Lock()
+	conn := c.conn
+	if !firstApproval {
+		// Authenticated: queued and unacknowledged events can go out
+		c.releaseWritesLocked()
 	}
+	c.mu.Unlock()
+	c.dispatch(func() {
+		if c.OnConfig != nil {
+			c.OnConfig(cfg)
+		}
+		if firstApproval {
+			slog.Info("First-time approval received — reconnecting to authenticate")
+			go c.reconnect(conn)
+		}
+	})
 }
 
 // handleRejected — server rejected our token.
-func (c *Client) handleRejected(rawMsg []byte) {
+func (c *Client) handleRejected() {
 	slog.Warn("Watcher rejected by server — clearing token and state")
 
 	// Clear token in memory
 	empty := ""
 	c.token.Store(&empty)
 
-	// Notify main to clear the state file
-	// We signal this by calling OnConfig with a zero-value config that has an empty token
-	// But actually the cleanest way is to use a dedicated callback...
-	// For now, just log — the state.Clear() will be handled by main via OnConfig with empty token
-	if c.OnConfig != nil {
-		c.OnConfig(models.WatcherConfigData{AuthToken: "__rejected__"})
+	c.setState(StateRejected)
+
+	// Let main clear the persisted state file, after any config callback still queued
+	c.dispatch(func() {
+		if c.OnRejected != nil {
+			c.OnRejected()
+		}
+	})
+}
+
+// handleAck — the API acknowledged every event up to a sequence number.
+func (c *Client) handleAck(rawMsg []byte) {
+	var envelope struct {
+		Data models.WatcherAckData `json:"data"`
+	}
+	if err := json.Unmarshal(rawMsg, &envelope); err != nil {
+		slog.Warn("Failed to parse watcher.ack", "error", err)
+		return
+	}
+
+	if !c.acksEnabled.Swap(true) {
+		slog.Info("API acknowledges events — unacknowledged events will be resent after reconnect")
 	}
+	removed := c.acks.ack(envelope.Data.BootID, envelope.Data.Seq)
+	slog.Debug("Events acknowledged", "boot_id", envelope.Data.BootID, "seq", envelope.Data.Seq, "removed", removed)
 }
 
-func (c *Client) writeLoop() {
+// handleReplay — the API detected a gap and asks for events from a given sequence.
+func (c *Client) handleReplay(conn *gorilla_ws.Conn, rawMsg []byte) {
+	var envelope struct {
+		Data models.WatcherReplayData `json:"data"`
+	}
+	if err := json.Unmarshal(rawMsg, &envelope); err != nil {
+		slog.Warn("Failed to parse watcher.replay", "error", err)
+		return
+	}
+
+	req := envelope.Data
+	events, ok := c.acks.since(req.BootID, req.FromSeq)
+	slog.Info("Replaying events", "boot_id", req.BootID, "from_seq", req.FromSeq, "count", len(events))
+
+	for _, raw := range events {
+		if err := c.writeRaw(conn, raw); err != nil {
+			slog.Warn("Replay write failed", "error", err)
+			return
+		}
+	}
+
+	if !ok {
+		slog.Warn("Requested events are no longer retained, triggering resync scan", "boot_id", req.BootID, "from_seq", req.FromSeq)
+		if c.OnReconnect != nil {
+			go c.OnReconnect()
+		}
+	}
+}
+
+// writeLoop drains the outbound lanes onto conn, highest priority first, once the
+// connection is approved (writable closed). An entry is only popped once it has been
+// written, so a failed write is retried on the next connection. When the API acks
+// events, a popped entry is only released from its lane once acknowledged, so a
+// spooled event survives a restart until then. The loop exits as soon as conn is
+// no longer the active connection.
+func (c *Client) writeLoop(conn *gorilla_ws.Conn, writable <-chan struct{}) {
+	select {
+	case <-c.done:
+		return
+	case <-writable:
+	}
+	c.mu.Lock()
+	current := c.conn == conn
+	c.mu.Unlock()
+	if !current {
+		return
+	}
+
+	// Resend events the API never acknowledged on the previous connection.
+	if c.acksEnabled.Load() {
+		unacked := c.acks.all()
+		if len(unacked) > 0 {
+			slog.Info("Resending unacknowledged events", "count", len(unacked))
+		}
+		for _, raw := range unacked {
+			if err := c.writeRaw(conn, raw); err != nil {
+				if !errors.Is(err, errStaleConn) {
+					slog.Warn("WebSocket write error", "error", err)
+					c.reconnect(conn)
+				}
+				return
+			}
+		}
+	}
+
 	for {
 		select {
 		case <-c.done:
 			return
-		case msg := <-c.msgChan:
-			if err := c.writeJSON(msg); err != nil {
-				slog.Warn("WebSocket write error", "error", err, "type", msg.Type)
-				c.reconnect()
+		default:
+		}
+
+		// Grab every wakeup channel before peeking so a Push in between is not missed.
+		var ready [laneCount]<-chan struct{}
+		for l, lq := range c.lanes {
+			ready[l] = lq.q.Ready()
+		}
+
+		lq, raw, ok := c.nextOutbound()
+		if !ok {
+			select {
+			case <-c.done:
 				return
+			case <-ready[laneControl]:
+			case <-ready[laneLive]:
+			case <-ready[laneScan]:
+			case <-ready[laneLogs]:
+			}
+			continue
+		}
+
+		seq := c.seq.Add(1)
+		stamped := stampSeq(raw, c.bootID, seq)
+		acked := c.acksEnabled.Load()
+
+		if err := c.writeRaw(conn, stamped); err != nil {
+			if errors.Is(err, errStaleConn) {
+				return
+			}
+			slog.Warn("WebSocket write error", "error", err)
+			if acked {
+				// The seq is spent: hand the event to the ack window so it is
+				// resent under the same seq rather than duplicated under a new one.
+				c.acks.addHeld(c.bootID, seq, stamped, lq.q)
+				lq.q.Pop()
 			}
+			c.reconnect(conn)
+			return
+		}
+		lq.q.Pop()
+
+		var kept bool
+		if acked {
+			kept = c.acks.addHeld(c.bootID, seq, stamped, lq.q)
+		} else {
+			// No ack will ever release it: the event is done with once written.
+			kept = c.acks.add(c.bootID, seq, stamped)
+			lq.q.Ack(1)
+		}
+		if !kept && acked && !c.droppedMessages.Swap(true) {
+			slog.Warn("Too many unacknowledged events, oldest can no longer be resent — a resync scan will be triggered on reconnection")
 		}
 	}
 }
 
-func (c *Client) pingLoop() {
-	interval := time.Duration(c.pingInterval.Load())
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// nextOutbound peeks the head of the highest-priority non-empty lane.
+func (c *Client) nextOutbound() (*laneQueue, []byte, bool) {
+	for _, lq := range c.lanes {
+		if raw, ok := lq.q.Peek(); ok {
+			return lq, raw, true
+		}
+	}
+	return nil, nil, false
+}
+
+// stampSeq prefixes an encoded message object with its boot ID and sequence number.
+func stampSeq(raw []byte, bootID string, seq uint64) []byte {
+	prefix := `{"boot_id":"` + bootID + `","seq":` + strconv.FormatUint(seq, 10)
+	out := make([]byte, 0, len(prefix)+len(raw)+1)
+	out = append(out, prefix...)
+	if len(raw) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, raw[1:]...)
+}
+
+// writeRaw writes an already-encoded message to conn if it is still the active connection.
+func (c *Client) writeRaw(conn *gorilla_ws.Conn, raw []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil || c.conn != conn {
+		return errStaleConn
+	}
+	return conn.WriteMessage(gorilla_ws.TextMessage, raw)
+}
+
+// pingLoop pings conn every ping interval and drops it when pongs stop coming back.
+// The interval is re-read on every tick, and SetPingInterval wakes the loop so a
+// change from watcher.config applies without reconnecting.
+func (c *Client) pingLoop(conn *gorilla_ws.Conn) {
+	timer := time.NewTimer(time.Duration(c.pingInterval.Load()))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-c.done:
 			return
-		case <-ticker.C:
-			c.mu.Lock()
-			conn := c.conn
-			c.mu.Unlock()
-
-			if conn == nil {
-				return
+		case <-c.pingReset:
+			if !timer.Stop() {
+				<-timer.C
 			}
+			// Restart the liveness window under the new interval, so shortening it
+			// does not condemn a connection that was healthy under the old one.
+			c.lastPong.Store(time.Now().UnixNano())
+			_ = conn.SetReadDeadline(time.Now().Add(c.pongTimeout()))
+			timer.Reset(time.Duration(c.pingInterval.Load()))
+			continue
+		case <-timer.C:
+		}
 
-			if err := conn.WriteControl(gorilla_ws.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-				slog.Warn("Ping failed", "error", err)
-				c.reconnect()
-				return
-			}
+		c.mu.Lock()
+		current := c.conn
+		c.mu.Unlock()
+
+		if current != conn {
+			return
 		}
+
+		if silence := time.Since(time.Unix(0, c.lastPong.Load())); silence > c.pongTimeout() {
+			slog.Warn("No pong received from the API, connection considered dead", "since", silence.Round(time.Second))
+			c.reconnect(conn)
+			return
+		}
+
+		if err := conn.WriteControl(gorilla_ws.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
+			slog.Warn("Ping failed", "error", err)
+			c.reconnect(conn)
+			return
+		}
+		timer.Reset(time.Duration(c.pingInterval.Load()))
 	}
 }
 
-func (c *Client) reconnect() {
+// reconnect drops conn and connects again in the background.
+// It is a no-op if conn has already been replaced, so every loop of a dead
+// connection can call it without triggering more than one reconnection.
+func (c *Client) reconnect(conn *gorilla_ws.Conn) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
 	if !c.reconnecting.CompareAndSwap(false, true) {
 		// Another goroutine is already reconnecting — skip
 		return
 	}
 
 	c.mu.Lock()
+	if c.conn != conn {
+		c.mu.Unlock()
+		c.reconnecting.Store(false)
+		return
+	}
 	if c.conn != nil {
 		_ = c.conn.Close()
 		c.conn = nil
 	}
+	c.releaseWritesLocked() // the write loop of conn exits
 	c.mu.Unlock()
+	c.setState(StateDisconnected)
 
 	slog.Info("Reconnecting to WebSocket...")
 	go func() {
@@ -455,7 +975,11 @@ func hostname() string {
 	return h
 }
 
+// Version is the watcher release, overridable at build time with
+// -ldflags "-X github.com/voclinx/scanarr-watcher/internal/websocket.Version=1.6.0".
+var Version = "1.5.0"
+
 // version returns the watcher version string.
 func version() string {
-	return "1.5.0-" + runtime.Version()
+	return Version + "-" + runtime.Version()
 }
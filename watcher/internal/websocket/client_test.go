@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -34,16 +35,33 @@ func httpToWs(url string) string {
 	return "ws" + strings.TrimPrefix(url, "http")
 }
 
-// readMessage reads a decoded models.Message from a connection.
-func readMessage(conn *gorilla_ws.Conn) (models.Message, error) {
+// stampedMessage is an outbound message as the API receives it, with the boot ID
+// and sequence number stamped by the write loop.
+type stampedMessage struct {
+	models.Message
+	BootID string `json:"boot_id"`
+	Seq    uint64 `json:"seq"`
+}
+
+// readMessage reads a decoded message from a connection.
+func readMessage(conn *gorilla_ws.Conn) (stampedMessage, error) {
 	_, raw, err := conn.ReadMessage()
 	if err != nil {
-		return models.Message{}, err
+		return stampedMessage{}, err
 	}
-	var msg models.Message
+	var msg stampedMessage
 	return msg, json.Unmarshal(raw, &msg)
 }
 
+// approve sends the watcher.config that approves the connection.
+func approve(conn *gorilla_ws.Conn) error {
+	return conn.WriteJSON(models.Message{
+		Type:      "watcher.config",
+		Timestamp: time.Now().UTC(),
+		Data:      models.WatcherConfigData{},
+	})
+}
+
 // TEST-GO-014: Client sends watcher.hello on connect (new protocol)
 func TestClient_SendsHelloOnConnect(t *testing.T) {
 	helloReceived := make(chan models.Message, 1)
@@ -56,7 +74,7 @@ func TestClient_SendsHelloOnConnect(t *testing.T) {
 			t.Logf("read error: %v", err)
 			return
 		}
-		helloReceived <- msg
+		helloReceived <- msg.Message
 		time.Sleep(500 * time.Millisecond)
 	})
 	defer server.Close()
@@ -244,6 +262,82 @@ func TestClient_PingPeriodic(t *testing.T) {
 	}
 }
 
+func TestClient_ReconnectsWhenPongsStop(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		mu.Lock()
+		connections++
+		mu.Unlock()
+
+		// Read hello, then stop reading: pings are never answered, like a peer
+		// behind a NAT that silently dropped the session.
+		_, _, _ = conn.ReadMessage()
+		time.Sleep(3 * time.Second)
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetReconnectDelay(100 * time.Millisecond)
+	client.SetPingInterval(100 * time.Millisecond)
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := connections
+		mu.Unlock()
+		if n >= 2 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("client did not reconnect after pongs stopped")
+}
+
+func TestClient_SetPingInterval_AppliesToRunningLoop(t *testing.T) {
+	pingReceived := make(chan struct{}, 100)
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		conn.SetPingHandler(func(appData string) error {
+			pingReceived <- struct{}{}
+			return conn.WriteControl(gorilla_ws.PongMessage, []byte(appData), time.Now().Add(5*time.Second))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetPingInterval(time.Hour)
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	client.SetPingInterval(50 * time.Millisecond)
+
+	select {
+	case <-pingReceived:
+	case <-time.After(time.Second):
+		t.Fatal("no ping received after lowering the interval on a running connection")
+	}
+	if !client.IsConnected() {
+		t.Error("client disconnected although pongs were answered")
+	}
+}
+
 // TEST-GO-018: Command received via OnCommand callback
 func TestClient_OnCommand_Scan(t *testing.T) {
 	commandReceived := make(chan models.Message, 1)
@@ -296,6 +390,76 @@ func TestClient_OnCommand_Scan(t *testing.T) {
 	}
 }
 
+func TestClient_SlowCommandKeepsConnection(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		mu.Lock()
+		connections++
+		first := connections == 1
+		mu.Unlock()
+
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		if first {
+			for _, id := range []string{"req-1", "req-2"} {
+				if err := conn.WriteJSON(models.Message{
+					Type: "command.watch.add",
+					Data: models.CommandWatchData{RequestID: id, Path: "/mnt/media"},
+				}); err != nil {
+					return
+				}
+			}
+		}
+		// Keep reading so pings are answered
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	// A command taking several pong timeouts, like watching a large tree
+	received := make(chan string, 2)
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetReconnectDelay(50 * time.Millisecond)
+	client.SetPingInterval(50 * time.Millisecond)
+	client.OnCommand = func(msg models.Message) {
+		time.Sleep(500 * time.Millisecond)
+		var cmd models.CommandWatchData
+		raw, _ := json.Marshal(msg.Data)
+		_ = json.Unmarshal(raw, &cmd)
+		received <- cmd.RequestID
+	}
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	for _, want := range []string{"req-1", "req-2"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("command %s delivered, want %s: commands must run in order", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+
+	mu.Lock()
+	n := connections
+	mu.Unlock()
+	if n != 1 || !client.IsConnected() {
+		t.Errorf("connections = %d, connected = %v; want the first connection kept while commands ran", n, client.IsConnected())
+	}
+}
+
 // TestClient_OnConfig_ReceivesConfig verifies that OnConfig is called on watcher.config messages.
 func TestClient_OnConfig_ReceivesConfig(t *testing.T) {
 	configReceived := make(chan models.WatcherConfigData, 1)
@@ -365,8 +529,11 @@ func TestClient_SendEvent(t *testing.T) {
 	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
 		defer conn.Close()
 
-		// Read hello
+		// Read hello, then approve: events are only written once approved
 		_, _, _ = conn.ReadMessage()
+		if err := approve(conn); err != nil {
+			return
+		}
 
 		for {
 			_, raw, err := conn.ReadMessage()
@@ -533,3 +700,327 @@ func TestClient_NoResync_WhenNoDroppedMessages(t *testing.T) {
 		// Good
 	}
 }
+
+// TestClient_SpoolReplaysAfterRestart verifies events queued while offline are
+// delivered by a new client process reusing the same spool directory.
+func TestClient_SpoolReplaysAfterRestart(t *testing.T) {
+	spoolDir := t.TempDir()
+
+	offline := NewClient("ws://localhost:9999/ws", "my-watcher-id")
+	if err := offline.EnableSpool(spoolDir, 1024*1024); err != nil {
+		t.Fatalf("EnableSpool() returned error: %v", err)
+	}
+	offline.SendEvent("file.deleted", models.FileDeletedData{Path: "/mnt/media/a.mkv", Name: "a.mkv"})
+	offline.SendEvent("file.deleted", models.FileDeletedData{Path: "/mnt/media/b.mkv", Name: "b.mkv"})
+	offline.Close()
+
+	received := make(chan stampedMessage, 10)
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		// Read hello, then approve: events are only written once approved
+		_, _, _ = conn.ReadMessage()
+		if err := approve(conn); err != nil {
+			return
+		}
+
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			received <- msg
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := client.EnableSpool(spoolDir, 1024*1024); err != nil {
+		t.Fatalf("EnableSpool() returned error: %v", err)
+	}
+	if client.QueueLen() != 2 {
+		t.Errorf("QueueLen() = %d, want 2", client.QueueLen())
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	for _, want := range []string{"/mnt/media/a.mkv", "/mnt/media/b.mkv"} {
+		select {
+		case msg := <-received:
+			data, _ := msg.Data.(map[string]interface{})
+			if msg.Type != "file.deleted" || data["path"] != want {
+				t.Errorf("replayed message = %s %v, want file.deleted %s", msg.Type, data["path"], want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for replayed event %s", want)
+		}
+	}
+}
+
+// TestClient_UnackedSpoolEventsSurviveRestart verifies spooled events that were
+// written but never acknowledged are sent again by the next process.
+func TestClient_UnackedSpoolEventsSurviveRestart(t *testing.T) {
+	spoolDir := t.TempDir()
+	received := make(chan stampedMessage, 10)
+	var connections atomic.Int32
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		first := connections.Add(1) == 1
+
+		_, _, _ = conn.ReadMessage()
+		err := conn.WriteJSON(models.Message{
+			Type:      "watcher.config",
+			Timestamp: time.Now().UTC(),
+			Data:      models.WatcherConfigData{ProtocolVersion: ProtocolVersion, Capabilities: []string{CapAcks}},
+		})
+		if err != nil {
+			return
+		}
+
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			received <- msg
+			// The first process only gets its first event acknowledged
+			data, _ := msg.Data.(map[string]interface{})
+			if first && data["path"] == "/mnt/media/a.mkv" {
+				_ = conn.WriteJSON(models.Message{
+					Type:      "watcher.ack",
+					Timestamp: time.Now().UTC(),
+					Data:      models.WatcherAckData{BootID: msg.BootID, Seq: msg.Seq},
+				})
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := client.EnableSpool(spoolDir, 1024*1024); err != nil {
+		t.Fatalf("EnableSpool() returned error: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	for _, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		client.SendEvent("file.deleted", models.FileDeletedData{Path: "/mnt/media/" + name, Name: name})
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for event %d", i)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for client.UnackedLen() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := client.UnackedLen(); n != 2 {
+		t.Fatalf("UnackedLen() = %d, want 2", n)
+	}
+	client.Close()
+
+	restarted := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := restarted.EnableSpool(spoolDir, 1024*1024); err != nil {
+		t.Fatalf("EnableSpool() returned error: %v", err)
+	}
+	if restarted.QueueLen() != 2 {
+		t.Errorf("QueueLen() after restart = %d, want 2", restarted.QueueLen())
+	}
+	if err := restarted.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer restarted.Close()
+
+	for _, want := range []string{"/mnt/media/b.mkv", "/mnt/media/c.mkv"} {
+		select {
+		case msg := <-received:
+			data, _ := msg.Data.(map[string]interface{})
+			if data["path"] != want {
+				t.Errorf("resent event = %v, want %s", data["path"], want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for resent event %s", want)
+		}
+	}
+}
+
+// TestClient_WritesEventsOnceAuthenticated verifies queued events wait for the
+// config that completes authentication: the API drops anything sent before.
+func TestClient_WritesEventsOnceAuthenticated(t *testing.T) {
+	received := make(chan string, 10)
+	var mu sync.Mutex
+	var ignored []string
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		authenticated := false
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			switch {
+			case msg.Type == "watcher.hello":
+				// Let anything sent too early arrive before the challenge
+				time.Sleep(100 * time.Millisecond)
+				if err := conn.WriteJSON(models.Message{Type: "watcher.auth_required", Timestamp: time.Now().UTC()}); err != nil {
+					return
+				}
+			case msg.Type == "watcher.auth":
+				authenticated = true
+				if err := approve(conn); err != nil {
+					return
+				}
+			case !authenticated:
+				mu.Lock()
+				ignored = append(ignored, msg.Type)
+				mu.Unlock()
+			default:
+				received <- msg.Type
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetToken("my-secret-token")
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/media/a.mkv"})
+	client.SendEvent("file.deleted", models.FileDeletedData{Path: "/mnt/media/b.mkv"})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	for _, want := range []string{"file.created", "file.deleted"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("received %s, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			mu.Lock()
+			defer mu.Unlock()
+			t.Fatalf("timeout waiting for %s; ignored before authentication: %v", want, ignored)
+		}
+	}
+}
+
+// TestClient_SendEvent_Sequenced verifies outbound events carry the boot ID and increasing sequence numbers.
+func TestClient_SendEvent_Sequenced(t *testing.T) {
+	received := make(chan stampedMessage, 10)
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		// Read hello, then approve: events are only written once approved
+		_, _, _ = conn.ReadMessage()
+		if err := approve(conn); err != nil {
+			return
+		}
+
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			received <- msg
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/media/a.mkv"})
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/media/b.mkv"})
+
+	for want := uint64(1); want <= 2; want++ {
+		select {
+		case msg := <-received:
+			if msg.BootID != client.BootID() {
+				t.Errorf("boot_id = %q, want %q", msg.BootID, client.BootID())
+			}
+			if msg.Seq != want {
+				t.Errorf("seq = %d, want %d", msg.Seq, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for event seq %d", want)
+		}
+	}
+}
+
+// TestClient_ResendsUnackedAfterReconnect verifies events the API did not ack are resent on the next connection.
+func TestClient_ResendsUnackedAfterReconnect(t *testing.T) {
+	var mu sync.Mutex
+	connectionCount := 0
+	resent := make(chan stampedMessage, 10)
+
+	var client *Client
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		mu.Lock()
+		connectionCount++
+		count := connectionCount
+		mu.Unlock()
+
+		// Read hello, then approve: events are only written once approved
+		_, _, _ = conn.ReadMessage()
+		if err := approve(conn); err != nil {
+			return
+		}
+
+		if count == 1 {
+			// Ack seq 1 only, then drop the connection.
+			for i := 0; i < 2; i++ {
+				if _, err := readMessage(conn); err != nil {
+					return
+				}
+			}
+			_ = conn.WriteJSON(models.Message{
+				Type:      "watcher.ack",
+				Timestamp: time.Now().UTC(),
+				Data:      models.WatcherAckData{BootID: client.BootID(), Seq: 1},
+			})
+			time.Sleep(100 * time.Millisecond)
+			return
+		}
+
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			resent <- msg
+		}
+	})
+	defer server.Close()
+
+	client = NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetReconnectDelay(100 * time.Millisecond)
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/media/a.mkv"})
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/media/b.mkv"})
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case msg := <-resent:
+		if msg.Seq != 2 {
+			t.Errorf("resent seq = %d, want 2", msg.Seq)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for unacked event to be resent")
+	}
+}
@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// lane is a priority class of the outbound queue. Lower values are sent first.
+type lane int
+
+const (
+	laneControl lane = iota // command responses, status
+	laneLive                // live filesystem events
+	laneScan                // scan stream
+	laneLogs                // forwarded logs
+	laneCount
+)
+
+// dropPolicy decides what happens when a lane is full.
+type dropPolicy int
+
+const (
+	// dropNewestResync rejects the new event and flags a resync scan for the next reconnection.
+	dropNewestResync dropPolicy = iota
+	// dropOldest evicts the oldest pending entry to make room.
+	dropOldest
+)
+
+// laneSpec describes the buffer and overflow behaviour of a lane.
+type laneSpec struct {
+	name       string
+	memEntries int   // in-memory capacity
+	spoolShare int64 // share of the spool size, in eighths; 0 = never spooled
+	policy     dropPolicy
+}
+
+var laneSpecs = [laneCount]laneSpec{
+	laneControl: {name: "control", memEntries: 1000, spoolShare: 1, policy: dropNewestResync},
+	laneLive:    {name: "live", memEntries: 10000, spoolShare: 3, policy: dropNewestResync},
+	laneScan:    {name: "scan", memEntries: 10000, spoolShare: 4, policy: dropNewestResync},
+	laneLogs:    {name: "logs", memEntries: 2000, policy: dropOldest},
+}
+
+// laneQueue is the outbox of one lane plus its drop counter.
+type laneQueue struct {
+	spec    laneSpec
+	q       outbox
+	dropped atomic.Uint64
+}
+
+// newLanes creates in-memory queues for every lane.
+func newLanes() [laneCount]*laneQueue {
+	var lanes [laneCount]*laneQueue
+	for l, spec := range laneSpecs {
+		mq := newMemQueue(spec.memEntries)
+		mq.evictOldest = spec.policy == dropOldest
+		lanes[l] = &laneQueue{spec: spec, q: mq}
+	}
+	return lanes
+}
+
+// laneFor classifies an outbound message type.
+func laneFor(msgType string) lane {
+	switch {
+	case msgType == "watcher.log":
+		return laneLogs
+	case msgType == "scan.status":
+		// A reply to command.scan.status, not part of a scan's stream
+		return laneControl
+	case strings.HasPrefix(msgType, "scan."):
+		return laneScan
+	case strings.HasPrefix(msgType, "file."):
+		return laneLive
+	default:
+		return laneControl
+	}
+}
+
+// spoolDirFor returns the spool subdirectory of a lane.
+func spoolDirFor(dir string, l lane) string {
+	return filepath.Join(dir, laneSpecs[l].name)
+}
+
+// migrateLegacySpool moves records left by the single-queue spool layout (segments
+// directly in dir) into the lane spools, then removes the old files.
+func migrateLegacySpool(dir string, lanes [laneCount]*laneQueue) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if len(matches) == 0 {
+		return
+	}
+
+	legacy, err := openSpool(dir, 1<<62)
+	if err != nil {
+		slog.Warn("Failed to open legacy event spool", "dir", dir, "error", err)
+		return
+	}
+
+	moved := 0
+	drained := false
+	for {
+		raw, ok := legacy.Peek()
+		if !ok {
+			drained = true
+			break
+		}
+		var hdr struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(raw, &hdr)
+		if err := lanes[laneFor(hdr.Type)].q.Push(raw); err != nil && !errors.Is(err, errEvictedOldest) {
+			break
+		}
+		legacy.Pop()
+		legacy.Ack(1)
+		moved++
+	}
+	_ = legacy.Close()
+
+	if !drained {
+		// Lanes are full; the rest stays in the legacy spool for the next start.
+		slog.Warn("Legacy event spool only partially migrated", "dir", dir, "events", moved)
+		return
+	}
+
+	matches, _ = filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	for _, m := range matches {
+		_ = os.Remove(m)
+	}
+	_ = os.Remove(filepath.Join(dir, spoolCursorFile))
+	slog.Info("Migrated legacy event spool", "dir", dir, "events", moved)
+}
@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	gorilla_ws "github.com/gorilla/websocket"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// TestLaneFor verifies message types are routed to the expected priority class.
+func TestLaneFor(t *testing.T) {
+	tests := []struct {
+		msgType string
+		want    lane
+	}{
+		{"files.delete.progress", laneControl},
+		{"files.hardlink.completed", laneControl},
+		{"watcher.status", laneControl},
+		{"file.created", laneLive},
+		{"file.renamed", laneLive},
+		{"scan.file", laneScan},
+		{"scan.files", laneScan},
+		{"scan.completed", laneScan},
+		{"scan.cancelled", laneScan},
+		{"scan.status", laneControl},
+		{"watcher.log", laneLogs},
+	}
+
+	for _, tt := range tests {
+		if got := laneFor(tt.msgType); got != tt.want {
+			t.Errorf("laneFor(%q) = %s, want %s", tt.msgType, laneSpecs[got].name, laneSpecs[tt.want].name)
+		}
+	}
+}
+
+// TestLogsLane_DropsOldest verifies a full log lane evicts old entries instead of flagging a resync.
+func TestLogsLane_DropsOldest(t *testing.T) {
+	client := NewClient("ws://localhost:9999/ws", "my-watcher-id")
+	capacity := laneSpecs[laneLogs].memEntries
+
+	for i := 0; i < capacity+5; i++ {
+		client.ForwardLog("info", "line", nil)
+	}
+
+	if got := client.QueueDepths()["logs"]; got != capacity {
+		t.Errorf("logs depth = %d, want %d", got, capacity)
+	}
+	if got := client.QueueDrops()["logs"]; got != 5 {
+		t.Errorf("logs drops = %d, want 5", got)
+	}
+	if client.droppedMessages.Load() {
+		t.Error("dropping logs flagged a resync, want no resync")
+	}
+}
+
+// TestClient_PriorityOrder verifies control events overtake queued scan events and logs.
+func TestClient_PriorityOrder(t *testing.T) {
+	received := make(chan stampedMessage, 10)
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		// Read hello, then approve: events are only written once approved
+		_, _, _ = conn.ReadMessage()
+		if err := approve(conn); err != nil {
+			return
+		}
+
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			received <- msg
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.ForwardLog("info", "log line", nil)
+	client.SendEvent("scan.file", models.ScanFileData{ScanID: "scan-1"})
+	client.SendEvent("file.created", models.FileCreatedData{Path: "/mnt/a.mkv"})
+	client.SendEvent("files.delete.completed", models.FilesDeleteCompletedData{RequestID: "req-1"})
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	want := []string{"files.delete.completed", "file.created", "scan.file", "watcher.log"}
+	for i, wantType := range want {
+		select {
+		case msg := <-received:
+			if msg.Type != wantType {
+				t.Errorf("message %d type = %q, want %q", i, msg.Type, wantType)
+			}
+			if msg.Seq != uint64(i+1) {
+				t.Errorf("message %d seq = %d, want %d (wire order)", i, msg.Seq, i+1)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %s", wantType)
+		}
+	}
+}
+
+// TestStampSeq verifies the boot ID and sequence are prepended to the encoded object.
+func TestStampSeq(t *testing.T) {
+	raw, _ := json.Marshal(models.Message{Type: "file.created"})
+	var msg stampedMessage
+	if err := json.Unmarshal(stampSeq(raw, "boot-a", 42), &msg); err != nil {
+		t.Fatalf("stamped message is not valid JSON: %v", err)
+	}
+	if msg.BootID != "boot-a" || msg.Seq != 42 || msg.Type != "file.created" {
+		t.Errorf("stamped = %+v, want boot-a/42/file.created", msg)
+	}
+
+	if got := string(stampSeq([]byte(`{}`), "b", 1)); got != `{"boot_id":"b","seq":1}` {
+		t.Errorf("stampSeq({}) = %s", got)
+	}
+}
+
+// TestEnableSpool_MigratesLegacyLayout verifies events spooled by the single-queue
+// layout are moved into the lane spools.
+func TestEnableSpool_MigratesLegacyLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	legacy, err := openSpool(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	for _, msgType := range []string{"scan.file", "file.deleted"} {
+		raw, _ := json.Marshal(models.Message{Type: msgType})
+		_ = legacy.Push(raw)
+	}
+	_ = legacy.Close()
+
+	client := NewClient("ws://localhost:9999/ws", "my-watcher-id")
+	if err := client.EnableSpool(dir, 1024*1024); err != nil {
+		t.Fatalf("EnableSpool() returned error: %v", err)
+	}
+	defer client.Close()
+
+	depths := client.QueueDepths()
+	if depths["scan"] != 1 || depths["live"] != 1 {
+		t.Errorf("depths = %v, want scan=1 live=1", depths)
+	}
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// errQueueFull is returned by outbox.Push when the queue cannot accept more entries.
+	errQueueFull = errors.New("outbound queue full")
+
+	// errEvictedOldest is returned by outbox.Push when the entry was queued by evicting the oldest one.
+	errEvictedOldest = errors.New("oldest entry evicted")
+)
+
+// outbox is the FIFO of encoded messages waiting to be written to the WebSocket.
+// Entries are only removed (Pop) once they have been written successfully, so a
+// write failure leaves the head entry in place for the next connection.
+type outbox interface {
+	// Push appends an encoded message. Returns errQueueFull when the queue is at capacity,
+	// or errEvictedOldest when room was made by dropping the oldest entry.
+	Push(raw []byte) error
+	// Peek returns the head entry without removing it.
+	Peek() ([]byte, bool)
+	// Pop removes the head entry returned by the last Peek.
+	Pop()
+	// Ack releases the n oldest popped entries once the API has acknowledged them.
+	// A durable queue keeps popped entries until then, so they are sent again
+	// after a restart.
+	Ack(n int)
+	// Ready returns a channel that is closed on the next Push.
+	// Grab it before calling Peek to avoid missing a wakeup.
+	Ready() <-chan struct{}
+	// Len returns the number of entries waiting to be sent.
+	Len() int
+	// Close releases any resources held by the queue.
+	Close() error
+}
+
+// memQueue is a bounded in-memory outbox. Its contents are lost on restart.
+type memQueue struct {
+	mu     sync.Mutex
+	items  [][]byte
+	max    int
+	signal chan struct{}
+
+	// evictOldest makes a full queue drop its oldest entry instead of rejecting the new one.
+	evictOldest bool
+	// inFlight is set between Peek and Pop: the head is being written and must not be evicted.
+	inFlight bool
+}
+
+func newMemQueue(max int) *memQueue {
+	return &memQueue{
+		max:    max,
+		signal: make(chan struct{}),
+	}
+}
+
+func (q *memQueue) Push(raw []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var err error
+	if len(q.items) >= q.max {
+		victim := 0
+		if q.inFlight {
+			victim = 1
+		}
+		if !q.evictOldest || victim >= len(q.items) {
+			return errQueueFull
+		}
+		q.items = append(q.items[:victim], q.items[victim+1:]...)
+		err = errEvictedOldest
+	}
+
+	q.items = append(q.items, raw)
+	close(q.signal)
+	q.signal = make(chan struct{})
+	return err
+}
+
+func (q *memQueue) Peek() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	q.inFlight = true
+	return q.items[0], true
+}
+
+func (q *memQueue) Pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 || !q.inFlight {
+		return
+	}
+	q.inFlight = false
+	q.items[0] = nil
+	q.items = q.items[1:]
+}
+
+// Ack is a no-op: popped entries are already gone from memory.
+func (q *memQueue) Ack(int) {}
+
+func (q *memQueue) Ready() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.signal
+}
+
+func (q *memQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *memQueue) Close() error {
+	return nil
+}
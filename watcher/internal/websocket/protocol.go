@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// ProtocolVersion is the highest protocol version this watcher speaks.
+// Version 1 is the original protocol, without negotiation.
+const ProtocolVersion = 2
+
+// Capabilities announced in watcher.hello.
+const (
+	// CapAcks — events carry boot_id/seq; the API sends watcher.ack and watcher.replay.
+	CapAcks = "acks"
+	// CapScanBatch — scan.file events may be coalesced into scan.files.
+	CapScanBatch = "scan.batch"
+	// CapCommandReply — commands are answered with command.accepted/rejected/failed.
+	CapCommandReply = "command.reply"
+	// CapScanIncremental — reconciliation scans may report only scan.added,
+	// scan.changed and scan.removed since the previous scan of the path.
+	CapScanIncremental = "scan.incremental"
+)
+
+// HashPartialSHA256 is SHA-256 over the first and last MiB of a file (see internal/hash).
+const HashPartialSHA256 = "partial-sha256"
+
+// supportedCapabilities and supportedHashAlgorithms are sent in every watcher.hello.
+var (
+	supportedCapabilities   = []string{CapAcks, CapScanBatch, CapCommandReply, CapScanIncremental}
+	supportedHashAlgorithms = []string{HashPartialSHA256}
+)
+
+// Protocol is what the API pinned for the current session in watcher.config.
+type Protocol struct {
+	// Version is 0 until the API answers, and stays 0 with APIs that predate negotiation.
+	Version       int
+	Capabilities  []string
+	HashAlgorithm string
+}
+
+// Negotiated reports whether the API took part in the negotiation.
+func (p Protocol) Negotiated() bool {
+	return p.Version > 0
+}
+
+// Has reports whether the named capability was agreed. Always false when nothing was negotiated.
+func (p Protocol) Has(name string) bool {
+	return slices.Contains(p.Capabilities, name)
+}
+
+// negotiate derives the session protocol from a watcher.config. Capabilities and
+// hash algorithms the watcher never announced are dropped, so a newer API cannot
+// switch on something this build does not implement.
+func negotiate(cfg models.WatcherConfigData) Protocol {
+	if cfg.ProtocolVersion <= 0 {
+		return Protocol{HashAlgorithm: HashPartialSHA256}
+	}
+
+	p := Protocol{
+		Version:       min(cfg.ProtocolVersion, ProtocolVersion),
+		HashAlgorithm: HashPartialSHA256,
+	}
+	for _, name := range cfg.Capabilities {
+		switch {
+		case !slices.Contains(supportedCapabilities, name):
+			slog.Warn("API pinned a capability this watcher does not support, ignoring it", "capability", name)
+		case !p.Has(name):
+			p.Capabilities = append(p.Capabilities, name)
+		}
+	}
+	if cfg.HashAlgorithm != "" {
+		if slices.Contains(supportedHashAlgorithms, cfg.HashAlgorithm) {
+			p.HashAlgorithm = cfg.HashAlgorithm
+		} else {
+			slog.Warn("API pinned an unsupported hash algorithm, keeping the default",
+				"hash_algorithm", cfg.HashAlgorithm, "default", p.HashAlgorithm)
+		}
+	}
+	return p
+}
+
+// Protocol returns the protocol pinned by the API for the current session.
+func (c *Client) Protocol() Protocol {
+	if p := c.protocol.Load(); p != nil {
+		return *p
+	}
+	return Protocol{}
+}
+
+// Supports reports whether a capability may be used with the API. Against an API
+// that predates negotiation every capability is allowed: each feature then falls
+// back to its own signal (scan_batch_size, the first watcher.ack, ...).
+func (c *Client) Supports(name string) bool {
+	p := c.Protocol()
+	return !p.Negotiated() || p.Has(name)
+}
+
+// helloData builds the watcher.hello payload.
+func (c *Client) helloData() models.WatcherHelloData {
+	return models.WatcherHelloData{
+		WatcherID:       c.watcherID,
+		Hostname:        hostname(),
+		Version:         version(),
+		BootID:          c.bootID,
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    supportedCapabilities,
+		HashAlgorithms:  supportedHashAlgorithms,
+	}
+}
@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	gorilla_ws "github.com/gorilla/websocket"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+func TestNegotiate_LegacyAPI(t *testing.T) {
+	p := negotiate(models.WatcherConfigData{ConfigHash: "abc"})
+	if p.Negotiated() {
+		t.Error("config without protocol_version should not count as negotiated")
+	}
+	if p.HashAlgorithm != HashPartialSHA256 {
+		t.Errorf("HashAlgorithm = %q, want %q", p.HashAlgorithm, HashPartialSHA256)
+	}
+}
+
+func TestNegotiate_PinsSupportedSubset(t *testing.T) {
+	p := negotiate(models.WatcherConfigData{
+		ProtocolVersion: ProtocolVersion + 5,
+		Capabilities:    []string{CapAcks, "trash", CapAcks},
+		HashAlgorithm:   "xxh3",
+	})
+
+	if p.Version != ProtocolVersion {
+		t.Errorf("Version = %d, want %d (never above ours)", p.Version, ProtocolVersion)
+	}
+	if !slices.Equal(p.Capabilities, []string{CapAcks}) {
+		t.Errorf("Capabilities = %v, want [%s]", p.Capabilities, CapAcks)
+	}
+	if p.HashAlgorithm != HashPartialSHA256 {
+		t.Errorf("HashAlgorithm = %q, want fallback %q", p.HashAlgorithm, HashPartialSHA256)
+	}
+}
+
+func TestClient_HelloAnnouncesCapabilities(t *testing.T) {
+	helloReceived := make(chan []byte, 1)
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		helloReceived <- raw
+		time.Sleep(500 * time.Millisecond)
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	var hello struct {
+		Data models.WatcherHelloData `json:"data"`
+	}
+	select {
+	case raw := <-helloReceived:
+		if err := json.Unmarshal(raw, &hello); err != nil {
+			t.Fatalf("unmarshal hello: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for watcher.hello")
+	}
+
+	if hello.Data.ProtocolVersion != ProtocolVersion {
+		t.Errorf("protocol_version = %d, want %d", hello.Data.ProtocolVersion, ProtocolVersion)
+	}
+	for _, name := range []string{CapAcks, CapScanBatch, CapCommandReply, CapScanIncremental} {
+		if !slices.Contains(hello.Data.Capabilities, name) {
+			t.Errorf("capabilities = %v, missing %q", hello.Data.Capabilities, name)
+		}
+	}
+	if !slices.Contains(hello.Data.HashAlgorithms, HashPartialSHA256) {
+		t.Errorf("hash_algorithms = %v, missing %q", hello.Data.HashAlgorithms, HashPartialSHA256)
+	}
+}
+
+func TestClient_ConfigPinsProtocol(t *testing.T) {
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+		_, _, _ = conn.ReadMessage()
+		_ = conn.WriteJSON(models.Message{
+			Type:      "watcher.config",
+			Timestamp: time.Now().UTC(),
+			Data: models.WatcherConfigData{
+				ConfigHash:      "abc",
+				ScanBatchSize:   100,
+				ProtocolVersion: 2,
+				Capabilities:    []string{CapAcks},
+			},
+		})
+		time.Sleep(500 * time.Millisecond)
+	})
+	defer server.Close()
+
+	configured := make(chan struct{})
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.OnConfig = func(cfg models.WatcherConfigData) {
+		client.SetScanBatching(cfg.ScanBatchSize, 0)
+		close(configured)
+	}
+	if !client.Supports(CapScanBatch) {
+		t.Error("before negotiation every capability should be allowed")
+	}
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case <-configured:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for watcher.config")
+	}
+
+	if !client.Supports(CapAcks) || !client.acksEnabled.Load() {
+		t.Error("acks were pinned: they should be enabled without waiting for a first watcher.ack")
+	}
+	if client.Supports(CapScanBatch) || client.batcher.enabled() {
+		t.Error("scan.batch was not pinned: batching must stay off despite scan_batch_size")
+	}
+}
@@ -0,0 +1,437 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// spoolSegmentBytes is the size at which the spool rolls over to a new segment file.
+	spoolSegmentBytes = 16 * 1024 * 1024
+
+	// spoolCursorEvery controls how often (in acknowledged records) the cursor is persisted.
+	// A crash replays at most this many already-acknowledged events, which the API tolerates.
+	spoolCursorEvery = 64
+
+	spoolSegmentExt  = ".seg"
+	spoolCursorFile  = "cursor.json"
+	spoolHeaderBytes = 4
+)
+
+// spool is an append-only, size-bounded on-disk outbox.
+//
+// Records are stored as a 4-byte little-endian length followed by the encoded
+// message, in numbered segment files. A popped record stays on disk until it is
+// acknowledged (Ack): only then does it count as consumed. Fully consumed segments
+// are deleted and the consumed position is kept in cursor.json, so pending and
+// unacknowledged events survive disconnects and watcher restarts. Writes are not
+// fsynced: the spool protects against process restarts, not power loss.
+type spool struct {
+	dir      string
+	maxBytes int64
+
+	mu         sync.Mutex
+	segments   []uint64         // segment ids, oldest first
+	sizes      map[uint64]int64 // on-disk size of each segment
+	totalBytes int64
+	count      int
+
+	w     *os.File
+	wID   uint64
+	wSize int64
+
+	// Read position: the next record Peek returns.
+	r    *os.File
+	rID  uint64
+	rOff int64
+
+	// cOff is the consumed position in the head segment: records before it are acknowledged.
+	cOff int64
+	// popped holds the records popped but not acknowledged yet, oldest first.
+	popped []spoolRecord
+
+	pending       []byte
+	acksSinceSave int
+	signal        chan struct{}
+}
+
+// spoolRecord locates a popped record: its segment and the offset just past it.
+type spoolRecord struct {
+	segment uint64
+	end     int64
+}
+
+// spoolCursor is the persisted consumed position.
+type spoolCursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// openSpool opens (or creates) a spool in dir. Existing segments are kept and replayed
+// from the persisted cursor; a new segment is always started for writing.
+func openSpool(dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		sizes:    make(map[uint64]int64),
+		signal:   make(chan struct{}),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+		s.sizes[id] = info.Size()
+		s.totalBytes += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	// Drop segments that were already consumed before the cursor was saved.
+	cur := s.loadCursor()
+	for len(s.segments) > 0 && s.segments[0] < cur.Segment {
+		s.removeSegment(s.segments[0])
+	}
+	if len(s.segments) > 0 && s.segments[0] == cur.Segment {
+		s.cOff = cur.Offset
+	}
+
+	s.count = s.countRecords()
+
+	next := uint64(1)
+	if n := len(s.segments); n > 0 {
+		next = s.segments[n-1] + 1
+	}
+	if err := s.openWriteSegment(next); err != nil {
+		return nil, err
+	}
+
+	// Everything not acknowledged is read again, including records sent before the restart.
+	s.rID = s.segments[0]
+	s.rOff = s.cOff
+
+	return s, nil
+}
+
+func (s *spool) Push(raw []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		return os.ErrClosed
+	}
+
+	// Only unacknowledged records count against the budget: the head segment up
+	// to the consumed offset is done with.
+	recLen := int64(spoolHeaderBytes + len(raw))
+	if s.totalBytes-s.cOff+recLen > s.maxBytes {
+		return errQueueFull
+	}
+
+	if s.wSize >= min(spoolSegmentBytes, s.maxBytes) {
+		if err := s.openWriteSegment(s.wID + 1); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, recLen)
+	binary.LittleEndian.PutUint32(buf, uint32(len(raw)))
+	copy(buf[spoolHeaderBytes:], raw)
+	if _, err := s.w.Write(buf); err != nil {
+		return fmt.Errorf("write spool segment: %w", err)
+	}
+
+	s.wSize += recLen
+	s.sizes[s.wID] = s.wSize
+	s.totalBytes += recLen
+	s.count++
+
+	close(s.signal)
+	s.signal = make(chan struct{})
+	return nil
+}
+
+func (s *spool) Peek() ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		return s.pending, true
+	}
+
+	for {
+		if s.r == nil {
+			if err := s.openReadSegment(s.rID); err != nil {
+				return nil, false
+			}
+		}
+
+		rec, err := readSpoolRecord(s.r, s.rOff)
+		if err == nil {
+			s.pending = rec
+			return rec, true
+		}
+
+		// End of segment (or a record truncated by a crash). The write segment is
+		// simply caught up; otherwise move on to the next segment. The read one is
+		// removed by Ack once its records are acknowledged.
+		next, ok := s.segmentAfter(s.rID)
+		if s.rID == s.wID || !ok {
+			return nil, false
+		}
+		_ = s.r.Close()
+		s.r = nil
+		s.rID = next
+		s.rOff = 0
+	}
+}
+
+func (s *spool) Pop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		return
+	}
+	s.rOff += int64(spoolHeaderBytes + len(s.pending))
+	s.pending = nil
+	s.popped = append(s.popped, spoolRecord{segment: s.rID, end: s.rOff})
+	if s.count > 0 {
+		s.count--
+	}
+}
+
+// Ack marks the n oldest popped records as consumed, freeing their space. Until
+// then they are kept on disk and read again after a restart.
+func (s *spool) Ack(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n = min(n, len(s.popped))
+	if n <= 0 || s.w == nil {
+		return
+	}
+	for _, rec := range s.popped[:n] {
+		for len(s.segments) > 1 && s.segments[0] != rec.segment {
+			s.removeSegment(s.segments[0])
+		}
+		s.cOff = rec.end
+	}
+	s.popped = append(s.popped[:0], s.popped[n:]...)
+
+	// Caught up with the writer: empty the write segment rather than let consumed
+	// records hold disk until it rolls over.
+	if len(s.segments) == 1 && len(s.popped) == 0 && s.rID == s.wID && s.cOff == s.wSize {
+		if err := s.w.Truncate(0); err == nil {
+			s.totalBytes -= s.wSize
+			s.wSize = 0
+			s.sizes[s.wID] = 0
+			s.rOff = 0
+			s.cOff = 0
+			s.saveCursor()
+			return
+		}
+	}
+
+	s.acksSinceSave += n
+	if s.acksSinceSave >= spoolCursorEvery {
+		s.saveCursor()
+	}
+}
+
+func (s *spool) Ready() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signal
+}
+
+func (s *spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (s *spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveCursor()
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+	if s.w != nil {
+		err := s.w.Close()
+		s.w = nil
+		return err
+	}
+	return nil
+}
+
+func (s *spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolSegmentExt))
+}
+
+func (s *spool) openWriteSegment(id uint64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open spool segment: %w", err)
+	}
+	if s.w != nil {
+		_ = s.w.Close()
+	}
+	s.w = f
+	s.wID = id
+	s.wSize = 0
+	if _, ok := s.sizes[id]; !ok {
+		s.segments = append(s.segments, id)
+		s.sizes[id] = 0
+	}
+	return nil
+}
+
+func (s *spool) openReadSegment(id uint64) error {
+	if s.r != nil {
+		_ = s.r.Close()
+		s.r = nil
+	}
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return err
+	}
+	s.r = f
+	s.rID = id
+	return nil
+}
+
+// segmentAfter returns the segment following id. Caller must hold s.mu.
+func (s *spool) segmentAfter(id uint64) (uint64, bool) {
+	for _, seg := range s.segments {
+		if seg > id {
+			return seg, true
+		}
+	}
+	return 0, false
+}
+
+// removeSegment deletes a fully consumed segment. Caller must hold s.mu (or be in openSpool).
+func (s *spool) removeSegment(id uint64) {
+	if s.r != nil && s.rID == id {
+		_ = s.r.Close()
+		s.r = nil
+	}
+	_ = os.Remove(s.segmentPath(id))
+	s.totalBytes -= s.sizes[id]
+	delete(s.sizes, id)
+	for i, seg := range s.segments {
+		if seg == id {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+}
+
+// countRecords walks record headers from the cursor to the end of the spool.
+func (s *spool) countRecords() int {
+	n := 0
+	for i, id := range s.segments {
+		f, err := os.Open(s.segmentPath(id))
+		if err != nil {
+			continue
+		}
+		off := int64(0)
+		if i == 0 {
+			off = s.cOff
+		}
+		hdr := make([]byte, spoolHeaderBytes)
+		for {
+			if _, err := f.ReadAt(hdr, off); err != nil {
+				break
+			}
+			next := off + spoolHeaderBytes + int64(binary.LittleEndian.Uint32(hdr))
+			if next > s.sizes[id] {
+				break // truncated tail
+			}
+			off = next
+			n++
+		}
+		_ = f.Close()
+	}
+	return n
+}
+
+func (s *spool) loadCursor() spoolCursor {
+	var cur spoolCursor
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolCursorFile))
+	if err != nil {
+		return cur
+	}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return spoolCursor{}
+	}
+	return cur
+}
+
+// saveCursor persists the consumed position. Caller must hold s.mu.
+func (s *spool) saveCursor() {
+	s.acksSinceSave = 0
+	cur := spoolCursor{Offset: s.cOff}
+	if len(s.segments) > 0 {
+		cur.Segment = s.segments[0]
+	}
+	data, err := json.Marshal(cur)
+	if err != nil {
+		return
+	}
+	tmp := filepath.Join(s.dir, spoolCursorFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, filepath.Join(s.dir, spoolCursorFile))
+}
+
+// readSpoolRecord reads the record starting at off. Returns io.EOF at the end of the
+// segment and io.ErrUnexpectedEOF for a truncated record.
+func readSpoolRecord(f *os.File, off int64) ([]byte, error) {
+	hdr := make([]byte, spoolHeaderBytes)
+	if _, err := f.ReadAt(hdr, off); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	rec := make([]byte, binary.LittleEndian.Uint32(hdr))
+	if _, err := f.ReadAt(rec, off+spoolHeaderBytes); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// drainSpool pops and acknowledges every pending record and returns them in order.
+func drainSpool(t *testing.T, s *spool) []string {
+	t.Helper()
+	var out []string
+	for {
+		raw, ok := s.Peek()
+		if !ok {
+			return out
+		}
+		out = append(out, string(raw))
+		s.Pop()
+		s.Ack(1)
+	}
+}
+
+// TestSpool_FIFO verifies records come back in the order they were pushed.
+func TestSpool_FIFO(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 1024*1024)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := s.Push([]byte(fmt.Sprintf("msg-%d", i))); err != nil {
+			t.Fatalf("Push(%d) returned error: %v", i, err)
+		}
+	}
+	if s.Len() != 10 {
+		t.Errorf("Len() = %d, want 10", s.Len())
+	}
+
+	got := drainSpool(t, s)
+	if len(got) != 10 {
+		t.Fatalf("drained %d records, want 10", len(got))
+	}
+	for i, rec := range got {
+		if want := fmt.Sprintf("msg-%d", i); rec != want {
+			t.Errorf("record %d = %q, want %q", i, rec, want)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("Len() after drain = %d, want 0", s.Len())
+	}
+}
+
+// TestSpool_PeekWithoutPopKeepsRecord verifies an unacknowledged record is returned again.
+func TestSpool_PeekWithoutPopKeepsRecord(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 1024*1024)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	defer s.Close()
+
+	_ = s.Push([]byte("first"))
+	_ = s.Push([]byte("second"))
+
+	a, _ := s.Peek()
+	b, _ := s.Peek()
+	if string(a) != "first" || string(b) != "first" {
+		t.Errorf("Peek() twice = %q, %q, want both %q", a, b, "first")
+	}
+}
+
+// TestSpool_SurvivesReopen verifies pending records are replayed after a restart.
+func TestSpool_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openSpool(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		_ = s.Push([]byte(fmt.Sprintf("msg-%d", i)))
+	}
+	// Send the first two and have them acknowledged, then "crash" via Close.
+	for i := 0; i < 2; i++ {
+		if _, ok := s.Peek(); !ok {
+			t.Fatal("Peek() returned no record")
+		}
+		s.Pop()
+	}
+	s.Ack(2)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+
+	s2, err := openSpool(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("reopen returned error: %v", err)
+	}
+	defer s2.Close()
+
+	if s2.Len() != 3 {
+		t.Errorf("Len() after reopen = %d, want 3", s2.Len())
+	}
+	_ = s2.Push([]byte("msg-5"))
+
+	got := drainSpool(t, s2)
+	want := []string{"msg-2", "msg-3", "msg-4", "msg-5"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("replayed = %v, want %v", got, want)
+	}
+}
+
+// TestSpool_UnackedSurviveReopen verifies popped records are replayed after a
+// restart until they are acknowledged.
+func TestSpool_UnackedSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openSpool(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		_ = s.Push([]byte(fmt.Sprintf("msg-%d", i)))
+	}
+	// All four are sent, only the first is acknowledged.
+	for i := 0; i < 4; i++ {
+		if _, ok := s.Peek(); !ok {
+			t.Fatal("Peek() returned no record")
+		}
+		s.Pop()
+	}
+	s.Ack(1)
+	if s.Len() != 0 {
+		t.Errorf("Len() after sending everything = %d, want 0", s.Len())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+
+	s2, err := openSpool(dir, 1024*1024)
+	if err != nil {
+		t.Fatalf("reopen returned error: %v", err)
+	}
+	defer s2.Close()
+
+	got := drainSpool(t, s2)
+	want := []string{"msg-1", "msg-2", "msg-3"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("replayed = %v, want %v", got, want)
+	}
+}
+
+// TestSpool_Overflow verifies Push fails once the size bound is reached.
+func TestSpool_Overflow(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 64)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	defer s.Close()
+
+	payload := make([]byte, 20)
+	var pushErr error
+	pushed := 0
+	for i := 0; i < 10 && pushErr == nil; i++ {
+		if pushErr = s.Push(payload); pushErr == nil {
+			pushed++
+		}
+	}
+
+	if pushErr != errQueueFull {
+		t.Errorf("Push() error = %v, want errQueueFull", pushErr)
+	}
+	if pushed != 2 {
+		t.Errorf("pushed = %d records of 24 bytes into 64, want 2", pushed)
+	}
+}
+
+// TestSpool_PushPopCycles verifies that sent records stop counting against the
+// size bound, with a bound far below the segment size.
+func TestSpool_PushPopCycles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 1024)
+	if err != nil {
+		t.Fatalf("openSpool() returned error: %v", err)
+	}
+	defer s.Close()
+
+	payload := make([]byte, 100)
+	for round := 0; round < 500; round++ {
+		for i := 0; i < 5; i++ {
+			if err := s.Push(payload); err != nil {
+				t.Fatalf("round %d: Push() error = %v with %d records queued", round, err, s.Len())
+			}
+		}
+		// Leave two records queued on odd rounds, so the reader also trails the writer
+		for s.Len() > round%2*2 {
+			if _, ok := s.Peek(); !ok {
+				t.Fatalf("round %d: Peek() found nothing with %d records queued", round, s.Len())
+			}
+			s.Pop()
+			s.Ack(1)
+		}
+	}
+
+	var onDisk int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && strings.HasSuffix(e.Name(), spoolSegmentExt) {
+			onDisk += info.Size()
+		}
+	}
+	if onDisk > 2*1024 {
+		t.Errorf("segments hold %d bytes on disk, want at most twice the 1024-byte bound", onDisk)
+	}
+}
@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+)
+
+// State is the lifecycle state of the connection to the API.
+type State int32
+
+const (
+	// StateDisconnected — no connection (initial state, after a drop, or after Close).
+	StateDisconnected State = iota
+	// StateConnecting — dialing and sending watcher.hello.
+	StateConnecting
+	// StatePendingApproval — connected without a token, waiting for an admin to approve us.
+	StatePendingApproval
+	// StateAuthenticating — watcher.auth sent, waiting for the config.
+	StateAuthenticating
+	// StateApproved — authenticated, config received.
+	StateApproved
+	// StateRejected — the API rejected our token; a new approval is required.
+	StateRejected
+)
+
+// String returns the name used in logs and the status payload.
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StatePendingApproval:
+		return "pending_approval"
+	case StateAuthenticating:
+		return "authenticating"
+	case StateApproved:
+		return "approved"
+	case StateRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the current lifecycle state.
+func (c *Client) State() State {
+	return State(c.state.Load())
+}
+
+// setState records a transition, logs it and notifies OnStateChange. No-op if
+// unchanged. Transitions an operator acts on are logged at Info, the others at Debug.
+func (c *Client) setState(next State) {
+	prev := State(c.state.Swap(int32(next)))
+	if prev == next {
+		return
+	}
+	level := slog.LevelDebug
+	switch next {
+	case StatePendingApproval, StateApproved, StateRejected:
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, "Watcher state changed", "state", next.String(), "from", prev.String())
+	if c.OnStateChange != nil {
+		c.OnStateChange(prev, next)
+	}
+}
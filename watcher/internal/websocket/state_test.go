@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	gorilla_ws "github.com/gorilla/websocket"
+	"github.com/voclinx/scanarr-watcher/internal/models"
+)
+
+// waitForState polls until the client reaches want or the timeout expires.
+func waitForState(t *testing.T, c *Client, want State) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.State() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("state = %s, want %s", c.State(), want)
+}
+
+// TestClient_StateMachine_PendingThenApproved verifies transitions for a new watcher being approved.
+func TestClient_StateMachine_PendingThenApproved(t *testing.T) {
+	step := make(chan struct{})
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		// Read hello
+		_, _, _ = conn.ReadMessage()
+
+		_ = conn.WriteJSON(models.Message{Type: "watcher.pending", Timestamp: time.Now().UTC()})
+		<-step
+		_ = conn.WriteJSON(models.Message{
+			Type:      "watcher.config",
+			Timestamp: time.Now().UTC(),
+			Data:      models.WatcherConfigData{ConfigHash: "abc"},
+		})
+		time.Sleep(500 * time.Millisecond)
+	})
+	defer server.Close()
+
+	var transitions []State
+	transitionCh := make(chan State, 10)
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.OnStateChange = func(from, to State) {
+		transitionCh <- to
+	}
+	if client.State() != StateDisconnected {
+		t.Errorf("initial state = %s, want disconnected", client.State())
+	}
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	waitForState(t, client, StatePendingApproval)
+	close(step)
+	waitForState(t, client, StateApproved)
+
+	for len(transitionCh) > 0 {
+		transitions = append(transitions, <-transitionCh)
+	}
+	want := []State{StateConnecting, StatePendingApproval, StateApproved}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("transition %d = %s, want %s", i, transitions[i], want[i])
+		}
+	}
+}
+
+// TestClient_StateMachine_Rejected verifies rejection clears the token and calls OnRejected.
+func TestClient_StateMachine_Rejected(t *testing.T) {
+	rejected := make(chan struct{}, 1)
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		// Read hello
+		_, _, _ = conn.ReadMessage()
+
+		_ = conn.WriteJSON(models.Message{Type: "watcher.auth_required", Timestamp: time.Now().UTC()})
+		_, _, _ = conn.ReadMessage() // watcher.auth
+		_ = conn.WriteJSON(models.Message{Type: "watcher.rejected", Timestamp: time.Now().UTC()})
+		time.Sleep(500 * time.Millisecond)
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetToken("old-token")
+	client.OnRejected = func() {
+		rejected <- struct{}{}
+	}
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case <-rejected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for OnRejected")
+	}
+	if client.State() != StateRejected {
+		t.Errorf("state = %s, want rejected", client.State())
+	}
+	if client.GetToken() != "" {
+		t.Errorf("GetToken() = %q after rejection, want empty", client.GetToken())
+	}
+}
+
+// TestClient_RejectedAfterQueuedConfig verifies OnRejected runs after a config
+// callback queued before the rejection.
+func TestClient_RejectedAfterQueuedConfig(t *testing.T) {
+	calls := make(chan string, 2)
+
+	server := newTestServer(t, func(conn *gorilla_ws.Conn) {
+		defer conn.Close()
+
+		_, _, _ = conn.ReadMessage() // watcher.hello
+		_ = approve(conn)
+		_ = conn.WriteJSON(models.Message{Type: "watcher.rejected", Timestamp: time.Now().UTC()})
+		time.Sleep(500 * time.Millisecond)
+	})
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	client.SetToken("old-token")
+	client.OnConfig = func(models.WatcherConfigData) {
+		time.Sleep(100 * time.Millisecond)
+		calls <- "config"
+	}
+	client.OnRejected = func() {
+		calls <- "rejected"
+	}
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	defer client.Close()
+
+	for _, want := range []string{"config", "rejected"} {
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Fatalf("callback = %s, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %s callback", want)
+		}
+	}
+}
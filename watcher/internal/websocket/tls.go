@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig holds the optional TLS settings used for wss:// connections.
+// The zero value uses the system trust store with no client certificate.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of additional CAs trusted for the API certificate.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// PinnedSPKI lists base64 SHA-256 hashes of trusted SubjectPublicKeyInfo.
+	// When set, at least one certificate of the verified chain must match.
+	PinnedSPKI []string
+}
+
+// IsZero reports whether no TLS option is set.
+func (t TLSConfig) IsZero() bool {
+	return t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && len(t.PinnedSPKI) == 0
+}
+
+// build loads the referenced files and returns the resulting tls.Config.
+func (t TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file %s: %w", t.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate %s: %w", t.CertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(t.PinnedSPKI) > 0 {
+		pins := make(map[string]bool, len(t.PinnedSPKI))
+		for _, p := range t.PinnedSPKI {
+			p = strings.TrimPrefix(strings.TrimSpace(p), "sha256/")
+			raw, err := base64.StdEncoding.DecodeString(p)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("invalid SPKI pin %q: want base64 SHA-256", p)
+			}
+			pins[p] = true
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins)
+		}
+	}
+
+	return cfg, nil
+}
+
+// verifyPins checks that one of the verified chain certificates matches a pin.
+// Runs after normal chain verification, so pinning narrows trust and never widens it.
+func verifyPins(cs tls.ConnectionState, pins map[string]bool) error {
+	var presented []string
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			pin := spkiPin(cert)
+			if pins[pin] {
+				return nil
+			}
+			presented = append(presented, pin)
+		}
+	}
+	if len(presented) == 0 {
+		for _, cert := range cs.PeerCertificates {
+			presented = append(presented, spkiPin(cert))
+		}
+	}
+	return fmt.Errorf("certificate pin mismatch: server presented sha256/%s", strings.Join(presented, ", sha256/"))
+}
+
+// spkiPin returns the base64 SHA-256 of a certificate's SubjectPublicKeyInfo.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// describeDialError turns TLS handshake failures into actionable errors.
+// Other errors are returned unchanged.
+func describeDialError(err error) error {
+	var unknownAuth x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var header tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &unknownAuth):
+		return fmt.Errorf("TLS handshake failed: API certificate is signed by an unknown authority (set SCANARR_TLS_CA_FILE): %w", err)
+	case errors.As(err, &hostname):
+		return fmt.Errorf("TLS handshake failed: API certificate does not match the host in SCANARR_WS_URL: %w", err)
+	case errors.As(err, &invalid):
+		return fmt.Errorf("TLS handshake failed: API certificate is invalid or expired: %w", err)
+	case errors.As(err, &header):
+		return fmt.Errorf("TLS handshake failed: server did not answer with TLS (use ws:// instead of wss://?): %w", err)
+	case strings.Contains(err.Error(), "certificate pin mismatch"):
+		return fmt.Errorf("TLS handshake failed: %w", err)
+	case strings.Contains(err.Error(), "tls: ") && strings.Contains(err.Error(), "certificate"):
+		return fmt.Errorf("TLS handshake failed: API rejected the client certificate (check SCANARR_TLS_CERT_FILE/SCANARR_TLS_KEY_FILE): %w", err)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gorilla_ws "github.com/gorilla/websocket"
+)
+
+// newTLSTestServer starts a wss:// server that accepts the connection and reads until it closes.
+func newTLSTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	upgrader := gorilla_ws.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+// writeCAFile writes the test server certificate as a PEM CA bundle.
+func writeCAFile(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestTLS_UnknownAuthorityHasClearError verifies an untrusted certificate is reported clearly.
+func TestTLS_UnknownAuthorityHasClearError(t *testing.T) {
+	server := newTLSTestServer(t)
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	err := client.Connect()
+	if err == nil {
+		client.Close()
+		t.Fatal("Connect() succeeded against an untrusted certificate")
+	}
+	if !strings.Contains(err.Error(), "SCANARR_TLS_CA_FILE") {
+		t.Errorf("error = %q, want a hint about SCANARR_TLS_CA_FILE", err)
+	}
+}
+
+// TestTLS_CustomCA verifies a CA bundle makes the server certificate trusted.
+func TestTLS_CustomCA(t *testing.T) {
+	server := newTLSTestServer(t)
+	defer server.Close()
+
+	client := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := client.SetTLSConfig(TLSConfig{CAFile: writeCAFile(t, server)}); err != nil {
+		t.Fatalf("SetTLSConfig() returned error: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() returned error: %v", err)
+	}
+	client.Close()
+}
+
+// TestTLS_PinMatchAndMismatch verifies SPKI pinning accepts the right key and rejects others.
+func TestTLS_PinMatchAndMismatch(t *testing.T) {
+	server := newTLSTestServer(t)
+	defer server.Close()
+	caFile := writeCAFile(t, server)
+
+	good := NewClient(httpToWs(server.URL), "my-watcher-id")
+	if err := good.SetTLSConfig(TLSConfig{CAFile: caFile, PinnedSPKI: []string{spkiPin(server.Certificate())}}); err != nil {
+		t.Fatalf("SetTLSConfig() returned error: %v", err)
+	}
+	if err := good.Connect(); err != nil {
+		t.Fatalf("Connect() with matching pin returned error: %v", err)
+	}
+	good.Close()
+
+	bad := NewClient(httpToWs(server.URL), "my-watcher-id")
+	wrongPin := "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	if err := bad.SetTLSConfig(TLSConfig{CAFile: caFile, PinnedSPKI: []string{wrongPin}}); err != nil {
+		t.Fatalf("SetTLSConfig() returned error: %v", err)
+	}
+	err := bad.Connect()
+	if err == nil {
+		bad.Close()
+		t.Fatal("Connect() succeeded with a non-matching pin")
+	}
+	if !strings.Contains(err.Error(), "certificate pin mismatch") {
+		t.Errorf("error = %q, want certificate pin mismatch", err)
+	}
+}
+
+// TestTLSConfig_InvalidSettings verifies configuration errors are reported before connecting.
+func TestTLSConfig_InvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+		want string
+	}{
+		{"missing CA file", TLSConfig{CAFile: "/nonexistent/ca.pem"}, "read CA file"},
+		{"cert without key", TLSConfig{CertFile: "/etc/scanarr/watcher.crt"}, "must be set together"},
+		{"malformed pin", TLSConfig{PinnedSPKI: []string{"not-base64!"}}, "invalid SPKI pin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.cfg.build()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("build() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
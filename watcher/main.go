@@ -1,22 +1,25 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/voclinx/scanarr-watcher/internal/command"
 	"github.com/voclinx/scanarr-watcher/internal/config"
 	"github.com/voclinx/scanarr-watcher/internal/deleter"
+	"github.com/voclinx/scanarr-watcher/internal/hash"
 	"github.com/voclinx/scanarr-watcher/internal/logger"
 	"github.com/voclinx/scanarr-watcher/internal/models"
 	"github.com/voclinx/scanarr-watcher/internal/scanner"
+	"github.com/voclinx/scanarr-watcher/internal/schedule"
 	"github.com/voclinx/scanarr-watcher/internal/state"
 	"github.com/voclinx/scanarr-watcher/internal/watcher"
 	"github.com/voclinx/scanarr-watcher/internal/websocket"
@@ -62,12 +65,37 @@ func main() {
 	wsClient.SetReconnectDelay(time.Duration(rtCfg.WsReconnectDelaySecs) * time.Second)
 	wsClient.SetPingInterval(time.Duration(rtCfg.WsPingIntervalSecs) * time.Second)
 
+	// Apply TLS settings (custom CA, client certificate, pinning) for wss://
+	tlsCfg := websocket.TLSConfig{
+		CAFile:     envCfg.TLSCAFile,
+		CertFile:   envCfg.TLSCertFile,
+		KeyFile:    envCfg.TLSKeyFile,
+		PinnedSPKI: envCfg.TLSPins,
+	}
+	if !tlsCfg.IsZero() {
+		if err := wsClient.SetTLSConfig(tlsCfg); err != nil {
+			slog.Error("Invalid TLS configuration", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Spool outbound events to disk so they survive disconnects and restarts
+	if err := wsClient.EnableSpool(envCfg.SpoolDir, envCfg.SpoolMaxBytes); err != nil {
+		slog.Warn("Failed to open event spool, using in-memory buffer", "dir", envCfg.SpoolDir, "error", err)
+	}
+
 	// Restore cached token if available
 	if cachedState.AuthToken != "" {
 		wsClient.SetToken(cachedState.AuthToken)
 		slog.Info("Restored auth token from state")
 	}
 
+	// Partial hashes of unchanged files are served from disk rather than re-read
+	hashCache, err := hash.OpenCache(envCfg.HashCachePath, envCfg.HashCacheMaxEntries)
+	if err != nil {
+		slog.Warn("Failed to open hash cache, hashing every file", "path", envCfg.HashCachePath, "error", err)
+	}
+
 	// Step 5: Create components
 	fileScanner := scanner.New(wsClient)
 	fileWatcher, err := watcher.New(wsClient, rtCfg.WatchPaths)
@@ -76,6 +104,40 @@ func main() {
 		os.Exit(1)
 	}
 	fileDeleter := deleter.New(wsClient)
+	fileScanner.HashCache = hashCache
+	fileWatcher.SetHashCache(hashCache)
+	if err := fileWatcher.SetVolumeStore(envCfg.VolumeStatePath); err != nil {
+		slog.Warn("Failed to open volume state, unmounted shares are only detected once seen mounted", "path", envCfg.VolumeStatePath, "error", err)
+	}
+
+	// Never scan a watch path whose volume is unmounted: its files would look deleted
+	fileScanner.Available = fileWatcher.Available
+
+	// Remember what each scan saw, so scheduled scans can report only the changes
+	if err := fileScanner.EnableCatalog(envCfg.CatalogDir); err != nil {
+		slog.Warn("Failed to open scan catalog, all scans will be full", "dir", envCfg.CatalogDir, "error", err)
+	}
+
+	// Every scan goes through the manager: one at a time per path, cancellable
+	scans := scanner.NewManager(fileScanner)
+
+	// Reconciliation scans on the schedules of watcher.config; a run is skipped
+	// while the path is still being scanned. They are incremental when the API
+	// takes them. Scans after lost events (overflow, dropped spool, restart, volume
+	// back) stay full: a file created and deleted while events were lost is known
+	// to the API but absent from the catalog, and only a full scan drops it.
+	scanScheduler := schedule.New(func(path string) {
+		scanID := uuid.New().String()
+		slog.Info("Scheduled scan triggered", "path", path, "scan_id", scanID)
+		mode := scanner.ModeFull
+		if wsClient.Protocol().Has(websocket.CapScanIncremental) {
+			mode = scanner.ModeIncremental
+		}
+		job, _ := scans.Submit(path, scanID, mode)
+		if err := job.Wait(); err != nil {
+			slog.Error("Scheduled scan failed", "path", path, "error", err)
+		}
+	}, scans.Busy)
 
 	// watcherReady tracks whether we have received the first config and started components.
 	// Distinguishes first startup (scan all paths if ScanOnStart) from reconnections (scan new paths only).
@@ -84,15 +146,6 @@ func main() {
 
 	// Step 6: OnConfig callback — called when API sends watcher.config
 	wsClient.OnConfig = func(cfg models.WatcherConfigData) {
-		// Handle rejection signal
-		if cfg.AuthToken == "__rejected__" {
-			slog.Warn("Token rejected — clearing state file")
-			if err := state.Clear(); err != nil {
-				slog.Warn("Failed to clear state file", "error", err)
-			}
-			return
-		}
-
 		// Snapshot old config for diff logging
 		oldCfg := *rtCfg
 
@@ -116,6 +169,24 @@ func main() {
 		// Apply new log level dynamically
 		logger.SetLevel(rtCfg.LogLevel)
 
+		// Apply connection timings; the ping loop picks up a new interval immediately
+		wsClient.SetReconnectDelay(time.Duration(rtCfg.WsReconnectDelaySecs) * time.Second)
+		wsClient.SetPingInterval(time.Duration(rtCfg.WsPingIntervalSecs) * time.Second)
+
+		// Batch scan.file events only if the API advertises support for scan.files
+		wsClient.SetScanBatching(rtCfg.ScanBatchSize, time.Duration(rtCfg.ScanBatchFlushMs)*time.Millisecond)
+
+		// Hold file events until files are fully written
+		fileWatcher.SetSettleWindow(time.Duration(rtCfg.SettleWindowMs) * time.Millisecond)
+
+		// Poll network shares (auto) or the paths configured for polling; set before
+		// paths are added so they are watched in the right mode from the start
+		fileWatcher.SetPollInterval(time.Duration(rtCfg.PollIntervalSecs) * time.Second)
+		fileWatcher.SetPathModes(rtCfg.WatchModes)
+
+		scanScheduler.Set(rtCfg.ScanSchedules)
+		fileScanner.SetWorkers(rtCfg.ScanHashWorkers, rtCfg.ScanHashWorkersPerDev)
+
 		// Enable log forwarding to the API once authenticated (first config received)
 		logger.SetForwarder(wsClient)
 
@@ -136,7 +207,8 @@ func main() {
 					for _, path := range rtCfg.WatchPaths {
 						scanID := uuid.New().String()
 						slog.Info("Initial scan triggered", "path", path, "scan_id", scanID)
-						if err := fileScanner.Scan(path, scanID); err != nil {
+						job, _ := scans.Submit(path, scanID, scanner.ModeFull)
+						if err := job.Wait(); err != nil {
 							slog.Error("Initial scan failed", "path", path, "error", err)
 						}
 					}
@@ -145,63 +217,77 @@ func main() {
 		} else {
 			// Hot reload: log what changed, then apply path changes.
 			logConfigChanges(&oldCfg, rtCfg)
-			applyWatchPathChanges(fileWatcher, fileScanner, rtCfg.WatchPaths)
+			applyWatchPathChanges(fileWatcher, scans, rtCfg.WatchPaths)
+		}
+	}
+
+	// Token rejected by the API — forget it so the next start asks for approval again
+	wsClient.OnRejected = func() {
+		slog.Warn("Token rejected — clearing state file")
+		if err := state.Clear(); err != nil {
+			slog.Warn("Failed to clear state file", "error", err)
 		}
 	}
 
 	// Step 7: Handle commands from API
 	startTime := time.Now()
-	wsClient.OnCommand = func(msg models.Message) {
-		// Guard against delete commands when deletion is disabled
-		if msg.Type == "command.files.delete" {
-			mu.Lock()
-			disabled := deletionDisabled
-			mu.Unlock()
-			if disabled {
-				dataBytes, _ := json.Marshal(msg.Data)
-				var deleteCmd models.CommandFilesDeleteData
-				if err := json.Unmarshal(dataBytes, &deleteCmd); err == nil {
-					results := make([]models.FilesDeleteResultItem, len(deleteCmd.Files))
-					for i, f := range deleteCmd.Files {
-						results[i] = models.FilesDeleteResultItem{
-							MediaFileID: f.MediaFileID,
-							Status:      "failed",
-							Error:       "deletion disabled by watcher config",
-						}
-					}
-					wsClient.SendEvent("files.delete.completed", models.FilesDeleteCompletedData{
-						RequestID:  deleteCmd.RequestID,
-						DeletionID: deleteCmd.DeletionID,
-						Total:      len(deleteCmd.Files),
-						Deleted:    0,
-						Failed:     len(deleteCmd.Files),
-						Results:    results,
-					})
-					slog.Warn("Deletion disabled — command rejected",
-						"request_id", deleteCmd.RequestID,
-						"deletion_id", deleteCmd.DeletionID,
-						"files", len(deleteCmd.Files),
-					)
-				}
-				return
-			}
-		}
-		handleCommand(msg, fileScanner, fileWatcher, fileDeleter)
+	commands := command.NewHandler(wsClient, scans, fileWatcher, fileDeleter, hashCache)
+	commands.RepliesEnabled = func() bool { return wsClient.Supports(websocket.CapCommandReply) }
+	commands.DeletionDisabled = func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return deletionDisabled
 	}
+	wsClient.OnCommand = commands.Handle
 
-	// Step 8: Handle reconnection with dropped events — trigger a full resync scan
+	// Step 8: Handle reconnection with dropped events (spool overflow) — trigger a full resync scan
 	wsClient.OnReconnect = func() {
 		slog.Info("Resync scan triggered after reconnection with dropped events")
 		time.Sleep(2 * time.Second)
 		for _, path := range rtCfg.WatchPaths {
 			scanID := uuid.New().String()
 			slog.Info("Resync scanning path", "path", path, "scan_id", scanID)
-			if err := fileScanner.Scan(path, scanID); err != nil {
+			job, _ := scans.Submit(path, scanID, scanner.ModeFull)
+			if err := job.Wait(); err != nil {
 				slog.Error("Resync scan failed", "path", path, "error", err)
 			}
 		}
 	}
 
+	// Step 8b: Kernel event queue overflowed — rescan only the watch paths that lost events
+	fileWatcher.OnOverflow = func(paths []string) {
+		jobs := make([]*scanner.Job, len(paths))
+		scanIDs := make([]string, len(paths))
+		for i, path := range paths {
+			jobs[i], _ = scans.Submit(path, uuid.New().String(), scanner.ModeFull)
+			scanIDs[i] = jobs[i].ID
+			slog.Info("Overflow rescan of path", "path", path, "scan_id", scanIDs[i])
+		}
+		wsClient.SendEvent("watcher.overflow", models.WatcherOverflowData{
+			Paths:   paths,
+			ScanIDs: scanIDs,
+		})
+		go func() {
+			for i, job := range jobs {
+				if err := job.Wait(); err != nil {
+					slog.Error("Overflow rescan failed", "path", paths[i], "error", err)
+				}
+			}
+		}()
+	}
+
+	// Step 8c: A watch path's volume came back (or was mounted) — rescan it
+	fileWatcher.OnVolumeAvailable = func(path string) {
+		scanID := uuid.New().String()
+		slog.Info("Rescanning path after volume came back", "path", path, "scan_id", scanID)
+		job, _ := scans.Submit(path, scanID, scanner.ModeFull)
+		go func() {
+			if err := job.Wait(); err != nil {
+				slog.Error("Rescan after volume came back failed", "path", path, "error", err)
+			}
+		}()
+	}
+
 	// Step 9: Connect to WebSocket (with retry)
 	wsClient.ConnectWithRetry()
 
@@ -211,17 +297,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Step 10b: Persist the hash cache periodically; it is also saved on shutdown
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := hashCache.Save(); err != nil {
+				slog.Warn("Failed to save hash cache", "error", err)
+			}
+		}
+	}()
+
 	// Step 11: Send periodic status with watcher_id and config_hash
 	go func() {
 		ticker := time.NewTicker(60 * time.Second)
 		defer ticker.Stop()
 		for range ticker.C {
 			wsClient.SendEvent("watcher.status", models.WatcherStatusData{
-				Status:        "watching",
-				WatcherID:     envCfg.WatcherID,
-				ConfigHash:    wsClient.GetConfigHash(),
-				WatchedPaths:  fileWatcher.GetWatchedPaths(),
-				UptimeSeconds: int64(time.Since(startTime).Seconds()),
+				Status:          "watching",
+				ConnectionState: wsClient.State().String(),
+				WatcherID:       envCfg.WatcherID,
+				ConfigHash:      wsClient.GetConfigHash(),
+				WatchedPaths:    fileWatcher.GetWatchedPaths(),
+				UptimeSeconds:   int64(time.Since(startTime).Seconds()),
+				QueueDepths:     wsClient.QueueDepths(),
+				QueueDrops:      wsClient.QueueDrops(),
 			})
 		}
 	}()
@@ -232,7 +332,12 @@ func main() {
 	sig := <-sigChan
 
 	slog.Info("Shutting down", "signal", sig)
+	scanScheduler.Stop()
+	scans.Stop()
 	fileWatcher.Close()
+	if err := hashCache.Save(); err != nil {
+		slog.Warn("Failed to save hash cache", "error", err)
+	}
 	wsClient.Close()
 	slog.Info("Shutdown complete")
 }
@@ -248,6 +353,14 @@ func applyWatcherConfig(cfg models.WatcherConfigData, current *config.RuntimeCon
 		WsPingIntervalSecs:     current.WsPingIntervalSecs,
 		LogRetentionDays:       cfg.LogRetentionDays,
 		DebugLogRetentionHours: cfg.DebugLogRetentionHours,
+		ScanBatchSize:          cfg.ScanBatchSize,
+		ScanBatchFlushMs:       cfg.ScanBatchFlushMs,
+		SettleWindowMs:         cfg.SettleWindowMs,
+		WatchModes:             cfg.WatchModes,
+		PollIntervalSecs:       cfg.PollIntervalSecs,
+		ScanSchedules:          cfg.ScanSchedules,
+		ScanHashWorkers:        cfg.ScanHashWorkers,
+		ScanHashWorkersPerDev:  cfg.ScanHashWorkersPerDev,
 	}
 
 	if cfg.WsReconnectDelaySecs > 0 {
@@ -265,18 +378,19 @@ func applyWatcherConfig(cfg models.WatcherConfigData, current *config.RuntimeCon
 }
 
 // applyWatchPathChanges updates fsnotify paths.
-// If fs is non-nil, newly added paths are scanned immediately (hot-reload behavior).
-// Pass fs=nil on first startup to avoid double-scanning with ScanOnStart.
-func applyWatchPathChanges(fw *watcher.FileWatcher, fs *scanner.Scanner, newPaths []string) {
+// If scans is non-nil, newly added paths are scanned immediately (hot-reload behavior).
+// Pass scans=nil on first startup to avoid double-scanning with ScanOnStart.
+func applyWatchPathChanges(fw *watcher.FileWatcher, scans *scanner.Manager, newPaths []string) {
 	existing := fw.GetWatchedPaths()
 
 	existingSet := make(map[string]bool, len(existing))
 	for _, p := range existing {
 		existingSet[p] = true
 	}
+	// The watcher keeps paths in clean form ("/mnt/media/" is "/mnt/media")
 	newSet := make(map[string]bool, len(newPaths))
 	for _, p := range newPaths {
-		newSet[p] = true
+		newSet[filepath.Clean(p)] = true
 	}
 
 	// Add new paths; scan them if a scanner is provided (hot-reload)
@@ -286,11 +400,12 @@ func applyWatchPathChanges(fw *watcher.FileWatcher, fs *scanner.Scanner, newPath
 				slog.Error("Failed to add watch path", "path", p, "error", err)
 			} else {
 				slog.Info("Added watch path", "path", p)
-				if fs != nil {
+				if scans != nil {
 					go func(path string) {
 						scanID := uuid.New().String()
 						slog.Info("Scanning newly added path", "path", path, "scan_id", scanID)
-						if err := fs.Scan(path, scanID); err != nil {
+						job, _ := scans.Submit(path, scanID, scanner.ModeFull)
+						if err := job.Wait(); err != nil {
 							slog.Error("Scan of new path failed", "path", path, "error", err)
 						}
 					}(p)
@@ -311,91 +426,6 @@ func applyWatchPathChanges(fw *watcher.FileWatcher, fs *scanner.Scanner, newPath
 	}
 }
 
-func handleCommand(msg models.Message, fileScanner *scanner.Scanner, fileWatcher *watcher.FileWatcher, fileDeleter *deleter.Deleter) {
-	switch msg.Type {
-	case "command.scan":
-		dataBytes, err := json.Marshal(msg.Data)
-		if err != nil {
-			slog.Warn("Failed to marshal command data", "error", err)
-			return
-		}
-		var scanCmd models.CommandScanData
-		if err := json.Unmarshal(dataBytes, &scanCmd); err != nil {
-			slog.Warn("Failed to parse command.scan data", "error", err)
-			return
-		}
-		go func() {
-			if err := fileScanner.Scan(scanCmd.Path, scanCmd.ScanID); err != nil {
-				slog.Error("Scan failed", "path", scanCmd.Path, "error", err)
-			}
-		}()
-
-	case "command.watch.add":
-		dataBytes, _ := json.Marshal(msg.Data)
-		var watchCmd models.CommandWatchData
-		if err := json.Unmarshal(dataBytes, &watchCmd); err != nil {
-			return
-		}
-		if err := fileWatcher.AddPath(watchCmd.Path); err != nil {
-			slog.Error("Failed to add watch path", "path", watchCmd.Path, "error", err)
-		} else {
-			slog.Info("Added watch path", "path", watchCmd.Path)
-		}
-
-	case "command.watch.remove":
-		dataBytes, _ := json.Marshal(msg.Data)
-		var watchCmd models.CommandWatchData
-		if err := json.Unmarshal(dataBytes, &watchCmd); err != nil {
-			return
-		}
-		if err := fileWatcher.RemovePath(watchCmd.Path); err != nil {
-			slog.Error("Failed to remove watch path", "path", watchCmd.Path, "error", err)
-		} else {
-			slog.Info("Removed watch path", "path", watchCmd.Path)
-		}
-
-	case "command.files.delete":
-		dataBytes, err := json.Marshal(msg.Data)
-		if err != nil {
-			slog.Warn("Failed to marshal command data", "error", err)
-			return
-		}
-		var deleteCmd models.CommandFilesDeleteData
-		if err := json.Unmarshal(dataBytes, &deleteCmd); err != nil {
-			slog.Warn("Failed to parse command.files.delete data", "error", err)
-			return
-		}
-		slog.Info("Received delete command",
-			"request_id", deleteCmd.RequestID,
-			"deletion_id", deleteCmd.DeletionID,
-			"files", len(deleteCmd.Files),
-		)
-		go fileDeleter.ProcessDeleteCommand(deleteCmd)
-
-	case "command.files.hardlink":
-		dataBytes, err := json.Marshal(msg.Data)
-		if err != nil {
-			slog.Warn("Failed to marshal hardlink command data", "error", err)
-			return
-		}
-		var hardlinkCmd models.CommandFilesHardlinkData
-		if err := json.Unmarshal(dataBytes, &hardlinkCmd); err != nil {
-			slog.Warn("Failed to parse command.files.hardlink data", "error", err)
-			return
-		}
-		slog.Info("Received hardlink command",
-			"request_id", hardlinkCmd.RequestID,
-			"deletion_id", hardlinkCmd.DeletionID,
-			"source", hardlinkCmd.SourcePath,
-			"target", hardlinkCmd.TargetPath,
-		)
-		go fileDeleter.ProcessHardlinkCommand(hardlinkCmd)
-
-	default:
-		slog.Debug("Unknown command", "type", msg.Type)
-	}
-}
-
 // logConfigChanges emits a structured slog entry describing what changed between two configs.
 // The message itself contains a human-readable summary so it is immediately visible in the log
 // dialog without needing to inspect the context. Called only on hot-reload (not first startup).
@@ -423,6 +453,36 @@ func logConfigChanges(old, new *config.RuntimeConfig) {
 	if old.WsReconnectDelaySecs != new.WsReconnectDelaySecs {
 		changes = append(changes, change{"ws_reconnect_delay_seconds", fmt.Sprintf("ws_reconnect_delay_seconds %d → %d", old.WsReconnectDelaySecs, new.WsReconnectDelaySecs)})
 	}
+	if old.ScanBatchSize != new.ScanBatchSize {
+		changes = append(changes, change{"scan_batch_size", fmt.Sprintf("scan_batch_size %d → %d", old.ScanBatchSize, new.ScanBatchSize)})
+	}
+	if old.SettleWindowMs != new.SettleWindowMs {
+		changes = append(changes, change{"settle_window_ms", fmt.Sprintf("settle_window_ms %d → %d", old.SettleWindowMs, new.SettleWindowMs)})
+	}
+	for _, p := range new.WatchPaths {
+		if old.WatchModes[p] != new.WatchModes[p] {
+			changes = append(changes, change{"watch_modes", fmt.Sprintf("watch_modes %s: %s → %s", p, modeLabel(old.WatchModes[p]), modeLabel(new.WatchModes[p]))})
+		}
+	}
+	for p, spec := range new.ScanSchedules {
+		if old.ScanSchedules[p] != spec {
+			changes = append(changes, change{"scan_schedules", fmt.Sprintf("scan_schedules %s: %q → %q", p, old.ScanSchedules[p], spec)})
+		}
+	}
+	for p, spec := range old.ScanSchedules {
+		if _, ok := new.ScanSchedules[p]; !ok {
+			changes = append(changes, change{"scan_schedules", fmt.Sprintf("scan_schedules %s: %q → none", p, spec)})
+		}
+	}
+	if old.ScanHashWorkers != new.ScanHashWorkers {
+		changes = append(changes, change{"scan_hash_workers", fmt.Sprintf("scan_hash_workers %d → %d", old.ScanHashWorkers, new.ScanHashWorkers)})
+	}
+	if old.ScanHashWorkersPerDev != new.ScanHashWorkersPerDev {
+		changes = append(changes, change{"scan_hash_workers_per_device", fmt.Sprintf("scan_hash_workers_per_device %d → %d", old.ScanHashWorkersPerDev, new.ScanHashWorkersPerDev)})
+	}
+	if old.PollIntervalSecs != new.PollIntervalSecs {
+		changes = append(changes, change{"poll_interval_seconds", fmt.Sprintf("poll_interval_seconds %d → %d", old.PollIntervalSecs, new.PollIntervalSecs)})
+	}
 	if old.WsPingIntervalSecs != new.WsPingIntervalSecs {
 		changes = append(changes, change{"ws_ping_interval_seconds", fmt.Sprintf("ws_ping_interval_seconds %d → %d", old.WsPingIntervalSecs, new.WsPingIntervalSecs)})
 	}
@@ -447,6 +507,14 @@ func logConfigChanges(old, new *config.RuntimeConfig) {
 	slog.Info(msg, args...)
 }
 
+// modeLabel shows an unset watch mode as the default it stands for.
+func modeLabel(mode string) string {
+	if mode == "" {
+		return "auto"
+	}
+	return mode
+}
+
 // diffSlice returns elements present in a but not in b.
 func diffSlice(a, b []string) []string {
 	bSet := make(map[string]bool, len(b))